@@ -1,10 +1,13 @@
 package main
 
 import (
+	"bytes"
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -20,6 +23,7 @@ import (
 	"github.com/creativeprojects/resticprofile/remote"
 	"github.com/creativeprojects/resticprofile/term"
 	"github.com/creativeprojects/resticprofile/win"
+	"github.com/spf13/pflag"
 )
 
 type ownCommand struct {
@@ -56,12 +60,30 @@ var (
 			action:            showProfile,
 			needConfiguration: true,
 		},
+		{
+			name:              "explain",
+			description:       "display all the commands a profile would run, in order, with their environment",
+			action:            explainProfile,
+			needConfiguration: true,
+		},
+		{
+			name:              "convert",
+			description:       "convert the configuration file into another format (toml, yaml, json or hcl)",
+			action:            convertConfiguration,
+			needConfiguration: true,
+		},
 		{
 			name:              "random-key",
 			description:       "generate a cryptographically secure random key to use as a restic keyfile",
 			action:            randomKey,
 			needConfiguration: false,
 		},
+		{
+			name:              "init-profile",
+			description:       "create a new profile by answering a few questions, and add it to the configuration file",
+			action:            initProfile,
+			needConfiguration: false,
+		},
 		{
 			name:              "schedule",
 			description:       "schedule a backup",
@@ -76,6 +98,41 @@ var (
 			needConfiguration: true,
 			hide:              false,
 		},
+		{
+			name:              "watch",
+			description:       "watch the configuration file and update the scheduled jobs when it changes",
+			action:            watchConfiguration,
+			needConfiguration: true,
+			hide:              false,
+		},
+		{
+			name:              "daemon",
+			description:       "run the scheduled jobs of all the profiles, without using the scheduler of the system",
+			action:            runDaemon,
+			needConfiguration: true,
+			hide:              false,
+		},
+		{
+			name:              "history",
+			description:       "display the runs of the profile recorded in the history file, with their success rate",
+			action:            showHistory,
+			needConfiguration: true,
+			hide:              false,
+		},
+		{
+			name:              "check-freshness",
+			description:       "verify the last successful run of each command is not older than its max-age",
+			action:            checkFreshness,
+			needConfiguration: true,
+			hide:              false,
+		},
+		{
+			name:              "nagios",
+			description:       "display the health of a profile as a monitoring plugin (Nagios, Icinga, etc.)",
+			action:            nagiosPlugin,
+			needConfiguration: true,
+			hide:              false,
+		},
 		{
 			name:              "status",
 			description:       "display the status of a scheduled backup job",
@@ -119,6 +176,13 @@ func displayOwnCommands() {
 	_ = w.Flush()
 }
 
+// exitCodeError is returned by an own command which has already displayed its result, and needs a specific exit code
+type exitCodeError int
+
+func (e exitCodeError) Error() string {
+	return "exit status " + strconv.Itoa(int(e))
+}
+
 func isOwnCommand(command string, configurationLoaded bool) bool {
 	for _, commandDef := range ownCommands {
 		if commandDef.name == command && commandDef.needConfiguration == configurationLoaded {
@@ -235,16 +299,22 @@ func sortedMapKeys(data map[string][]string) []string {
 }
 
 func showProfile(c *config.Config, flags commandLineFlags, args []string) error {
-	// Show global section first
+	format := ""
+	showSecrets := false
+	flagset := pflag.NewFlagSet("show", pflag.ContinueOnError)
+	flagset.StringVar(&format, "format", "", "output format (json, yaml or toml)")
+	flagset.BoolVar(&showSecrets, "show-secrets", false, "display passwords and other secrets in clear")
+	err := flagset.Parse(args)
+	if err != nil {
+		return err
+	}
+
 	global, err := c.GetGlobalSection()
 	if err != nil {
 		return fmt.Errorf("cannot show global: %w", err)
 	}
-	fmt.Printf("\n%s:\n", constants.SectionConfigurationGlobal)
-	config.ShowStruct(os.Stdout, global)
 
-	// Then show profile
-	profile, err := c.GetProfile(flags.name)
+	profile, err := c.GetProfile(flags.name, "show")
 	if err != nil {
 		return fmt.Errorf("cannot show profile '%s': %w", flags.name, err)
 	}
@@ -253,14 +323,107 @@ func showProfile(c *config.Config, flags commandLineFlags, args []string) error
 	}
 	// All files in the configuration are relative to the configuration file, NOT the folder where resticprofile is started
 	// So we need to fix all relative files
-	rootPath := filepath.Dir(c.GetConfigFile())
+	rootPath := c.GetBaseDir()
 	if rootPath != "." {
 		clog.Debugf("files in configuration are relative to '%s'", rootPath)
 	}
 	profile.SetRootPath(rootPath)
+	profile.SetHost(getHostname())
+
+	if format != "" {
+		return exportProfile(os.Stdout, format, flags.name, global, profile, showSecrets)
+	}
+
+	// Show global section first
+	fmt.Printf("\n%s:\n", constants.SectionConfigurationGlobal)
+	config.ShowStruct(os.Stdout, global)
 
+	// Then show profile
 	fmt.Printf("\n%s:\n", flags.name)
 	config.ShowStruct(os.Stdout, profile)
+
+	// And the values coming from outside the configuration file
+	overrides := c.GetOverrides(flags.name)
+	if len(overrides) > 0 {
+		fmt.Printf("\noverrides:\n")
+		for _, override := range overrides {
+			fmt.Printf("    %s\n", override)
+		}
+		fmt.Println("")
+	}
+	return nil
+}
+
+// exportProfile writes the global section and the resolved profile in a machine-readable format
+func exportProfile(w io.Writer, format, profileName string, global *config.Global, profile *config.Profile, showSecrets bool) error {
+	globalMap, err := config.ToMap(global, showSecrets)
+	if err != nil {
+		return fmt.Errorf("cannot export global: %w", err)
+	}
+	profileMap, err := config.ToMap(profile, showSecrets)
+	if err != nil {
+		return fmt.Errorf("cannot export profile '%s': %w", profileName, err)
+	}
+	return config.Encode(w, format, map[string]interface{}{
+		constants.SectionConfigurationGlobal: globalMap,
+		profileName:                          profileMap,
+	})
+}
+
+// convertConfiguration writes the configuration file into another format, and verifies the profiles are identical after the conversion
+func convertConfiguration(c *config.Config, flags commandLineFlags, args []string) error {
+	format := ""
+	output := ""
+	executeTemplate := false
+	flagset := pflag.NewFlagSet("convert", pflag.ContinueOnError)
+	flagset.StringVar(&format, "format", "", "format of the converted configuration: toml, yaml, json or hcl (default is to use the output file extension)")
+	flagset.StringVarP(&output, "output", "o", "", "write the converted configuration into this file instead of the console")
+	flagset.BoolVar(&executeTemplate, "execute-template", false, "execute the template before converting: the converted configuration won't contain any template")
+	err := flagset.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if format == "" && output != "" {
+		format = strings.TrimPrefix(filepath.Ext(output), ".")
+	}
+	switch format {
+	case "":
+		return errors.New("missing format of the converted configuration (--format)")
+	case "yml":
+		format = config.FormatYAML
+	case "conf":
+		format = config.FormatTOML
+	}
+
+	source, err := c.Reload(executeTemplate)
+	if err != nil {
+		if !executeTemplate {
+			clog.Info("the template might need to be executed before the conversion (--execute-template)")
+		}
+		return fmt.Errorf("cannot load configuration file: %w", err)
+	}
+
+	buffer := &bytes.Buffer{}
+	err = source.Convert(buffer, format)
+	if err != nil {
+		return fmt.Errorf("cannot convert configuration: %w", err)
+	}
+	err = config.VerifyConversion(c, buffer.Bytes(), format)
+	if err != nil {
+		return fmt.Errorf("verification of the converted configuration failed: %w", err)
+	}
+
+	if output == "" {
+		_, err = os.Stdout.Write(buffer.Bytes())
+		return err
+	}
+	// the configuration might contain some secrets
+	err = ioutil.WriteFile(output, buffer.Bytes(), 0600)
+	if err != nil {
+		return err
+	}
+	clog.Infof("configuration converted into '%s'", output)
 	return nil
 }
 
@@ -279,20 +442,28 @@ func randomKey(c *config.Config, flags commandLineFlags, args []string) error {
 			return fmt.Errorf("invalid key size: %v", size)
 		}
 	}
+	err = generateRandomKey(os.Stdout, size)
+	fmt.Println("")
+	return err
+}
+
+// generateRandomKey writes a base64'd random key of the size in parameter (before encoding)
+func generateRandomKey(w io.Writer, size uint64) error {
 	buffer := make([]byte, size)
-	_, err = rand.Read(buffer)
+	_, err := rand.Read(buffer)
 	if err != nil {
 		return err
 	}
-	encoder := base64.NewEncoder(base64.StdEncoding, os.Stdout)
+	encoder := base64.NewEncoder(base64.StdEncoding, w)
 	_, err = encoder.Write(buffer)
-	encoder.Close()
-	fmt.Println("")
-	return err
+	if err != nil {
+		return err
+	}
+	return encoder.Close()
 }
 
 func createSchedule(c *config.Config, flags commandLineFlags, args []string) error {
-	profile, err := c.GetProfile(flags.name)
+	profile, err := c.GetProfile(flags.name, "schedule")
 	if err != nil {
 		return fmt.Errorf("cannot load profile '%s': %w", flags.name, err)
 	}
@@ -305,7 +476,11 @@ func createSchedule(c *config.Config, flags commandLineFlags, args []string) err
 		return fmt.Errorf("no schedule found for profile '%s'", flags.name)
 	}
 
-	err = scheduleJobs(flags.config, schedules)
+	if flags.config == constants.ConfigurationStdin {
+		return errors.New("cannot schedule a profile from a configuration read from stdin")
+	}
+
+	err = scheduleJobs(flags, schedules)
 	if err != nil {
 		return retryElevated(err, flags)
 	}
@@ -313,7 +488,7 @@ func createSchedule(c *config.Config, flags commandLineFlags, args []string) err
 }
 
 func removeSchedule(c *config.Config, flags commandLineFlags, args []string) error {
-	profile, err := c.GetProfile(flags.name)
+	profile, err := c.GetProfile(flags.name, "unschedule")
 	if err != nil {
 		return fmt.Errorf("cannot load profile '%s': %w", flags.name, err)
 	}
@@ -334,7 +509,7 @@ func removeSchedule(c *config.Config, flags commandLineFlags, args []string) err
 }
 
 func statusSchedule(c *config.Config, flags commandLineFlags, args []string) error {
-	profile, err := c.GetProfile(flags.name)
+	profile, err := c.GetProfile(flags.name, "status")
 	if err != nil {
 		return fmt.Errorf("cannot load profile '%s': %w", flags.name, err)
 	}
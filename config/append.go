@@ -0,0 +1,90 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// AppendProfile adds a new profile at the end of the configuration content.
+// The resulting configuration is loaded to make sure the new profile is valid
+func AppendProfile(content []byte, format, profileName string, profile map[string]interface{}) ([]byte, error) {
+	switch format {
+	case "conf":
+		format = FormatTOML
+	case "yml":
+		format = FormatYAML
+	}
+	sections := []section{{key: profileName, value: normalizeValue(profile)}}
+	buffer := &bytes.Buffer{}
+	var err error
+
+	if format == FormatJSON {
+		err = appendJSON(buffer, content, sections)
+	} else {
+		buffer.Write(content)
+		if len(content) > 0 && !bytes.HasSuffix(content, []byte("\n")) {
+			buffer.WriteString("\n")
+		}
+		if len(content) > 0 {
+			buffer.WriteString("\n")
+		}
+		switch format {
+		case FormatTOML:
+			err = encodeTOML(buffer, sections)
+		case FormatYAML:
+			err = encodeYAML(buffer, sections)
+		case FormatHCL:
+			err = encodeHCL(buffer, sections)
+		default:
+			err = fmt.Errorf("unsupported format '%s'", format)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// check the new configuration can be loaded
+	c, err := Load(bytes.NewReader(buffer.Bytes()), format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration after adding profile '%s': %w", profileName, err)
+	}
+	loaded, err := c.GetProfile(profileName, "")
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration after adding profile '%s': %w", profileName, err)
+	}
+	if loaded == nil {
+		return nil, fmt.Errorf("profile '%s' not found after adding it to the configuration", profileName)
+	}
+	return buffer.Bytes(), nil
+}
+
+// appendJSON adds the sections at the end of the main JSON object
+func appendJSON(buffer *bytes.Buffer, content []byte, sections []section) error {
+	encoded := &bytes.Buffer{}
+	err := encodeJSON(encoded, sections)
+	if err != nil {
+		return err
+	}
+	// remove the braces around the new sections
+	newSections := strings.TrimSuffix(strings.TrimPrefix(encoded.String(), "{\n"), "}\n")
+
+	existing := strings.TrimSpace(string(content))
+	if existing == "" {
+		buffer.WriteString(encoded.String())
+		return nil
+	}
+	if !strings.HasSuffix(existing, "}") {
+		return errors.New("expected a JSON object")
+	}
+	existing = strings.TrimRight(strings.TrimSuffix(existing, "}"), " \t\r\n")
+	buffer.WriteString(existing)
+	if !strings.HasSuffix(existing, "{") {
+		buffer.WriteString(",")
+	}
+	buffer.WriteString("\n")
+	buffer.WriteString(newSections)
+	buffer.WriteString("}\n")
+	return nil
+}
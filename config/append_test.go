@@ -0,0 +1,62 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppendProfile(t *testing.T) {
+	newProfile := map[string]interface{}{
+		"repository":    "local:/backup",
+		"password-file": "new-key",
+		"backup": map[string]interface{}{
+			"source": []string{"/home", "/etc"},
+		},
+	}
+	testData := []struct {
+		format   string
+		existing string
+	}{
+		{"toml", ""},
+		{"toml", "[global]\npriority = \"low\"\n\n[existing]\nrepository = \"/existing\""},
+		{"conf", "[existing]\nrepository = \"/existing\"\n"},
+		{"yaml", "existing:\n  repository: /existing\n"},
+		{"json", ""},
+		{"json", "{}"},
+		{"json", "{\n  \"existing\": {\n    \"repository\": \"/existing\"\n  }\n}\n"},
+		{"hcl", "existing {\n  repository = \"/existing\"\n}\n"},
+	}
+
+	for _, testItem := range testData {
+		t.Run(testItem.format+" "+testItem.existing, func(t *testing.T) {
+			content, err := AppendProfile([]byte(testItem.existing), testItem.format, "new", newProfile)
+			require.NoError(t, err)
+
+			format := testItem.format
+			if format == "conf" {
+				format = FormatTOML
+			}
+			profile, err := getResolvedProfile(format, string(content), "new")
+			require.NoError(t, err)
+			require.NotNil(t, profile)
+			assert.Equal(t, "local:/backup", profile.Repository)
+			assert.Equal(t, "new-key", profile.PasswordFile)
+			require.NotNil(t, profile.Backup)
+			assert.Equal(t, []string{"/home", "/etc"}, profile.Backup.Source)
+
+			if testItem.existing != "" && testItem.existing != "{}" {
+				existing, err := getResolvedProfile(format, string(content), "existing")
+				require.NoError(t, err)
+				require.NotNil(t, existing)
+				assert.Equal(t, "/existing", existing.Repository)
+			}
+		})
+	}
+}
+
+func TestAppendProfileToInvalidJSON(t *testing.T) {
+	_, err := AppendProfile([]byte("[]"), FormatJSON, "new", map[string]interface{}{"repository": "/backup"})
+	assert.Error(t, err)
+}
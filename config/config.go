@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -22,9 +23,15 @@ type Config struct {
 	keyDelim       string
 	format         string
 	configFile     string
+	baseDir        string
 	viper          *viper.Viper
 	groups         map[string][]string
 	sourceTemplate *template.Template
+	variables      map[string]string
+	source         []byte
+	rawSource      []byte
+	overrides      []override
+	currentProfile string
 }
 
 // This is where things are getting hairy:
@@ -41,11 +48,7 @@ type Config struct {
 // }
 //
 // For that matter, viper creates a slice of maps instead of a map for the other configuration file formats
-// This configOptionHCL deals with the slice to merge it into a single map
-var (
-	configOption    = viper.DecodeHook(nil)
-	configOptionHCL = viper.DecodeHook(sliceOfMapsToMapHookFunc())
-)
+// The sliceOfMapsToMapHookFunc deals with the slice to merge it into a single map (see decodeHook)
 
 // newConfig instantiate a new Config object
 func newConfig(format string) *Config {
@@ -59,33 +62,60 @@ func newConfig(format string) *Config {
 // LoadFile loads configuration from file
 // Leave format blank for auto-detection from the file extension
 func LoadFile(configFile, format string) (*Config, error) {
+	file, err := os.Open(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open configuration file for reading: %w", err)
+	}
+	defer file.Close()
+
+	return loadSource(file, configFile, format, "", true)
+}
+
+// LoadSource loads configuration from a reader, like the standard input or the body of a HTTP response.
+// The name of the source is used to detect the format when left blank.
+// All the relative paths in the configuration are resolved from baseDir (leave blank for the directory of the source)
+func LoadSource(input io.Reader, name, format, baseDir string) (*Config, error) {
+	return loadSource(input, name, format, baseDir, true)
+}
+
+func loadSource(input io.Reader, name, format, baseDir string, executeTemplate bool) (*Config, error) {
 	if format == "" {
 		// use file extension as format
-		format = strings.TrimPrefix(filepath.Ext(configFile), ".")
+		format = strings.TrimPrefix(filepath.Ext(name), ".")
 	}
-	file, err := os.Open(configFile)
+	// keep a copy of the original content so it can be loaded again
+	rawSource, err := ioutil.ReadAll(input)
 	if err != nil {
-		return nil, fmt.Errorf("cannot open configuration file for reading: %w", err)
+		return nil, fmt.Errorf("cannot read configuration: %w", err)
 	}
+
 	c := newConfig(format)
-	c.configFile = configFile
-	// err = c.load(file)
-	err = c.loadTemplate(file)
+	c.configFile = name
+	c.baseDir = baseDir
+	c.rawSource = rawSource
+	if !executeTemplate {
+		err = c.load(bytes.NewReader(rawSource))
+		if err != nil {
+			return c, err
+		}
+		return c, nil
+	}
+	err = c.loadTemplate(bytes.NewReader(rawSource))
 	if err != nil {
 		return c, err
 	}
 	return c, nil
 }
 
+// Reload loads the original content of the configuration again, in a new Config.
+// It's useful to get a version of the configuration without executing the template
+func (c *Config) Reload(executeTemplate bool) (*Config, error) {
+	return loadSource(bytes.NewReader(c.rawSource), c.configFile, c.format, c.baseDir, executeTemplate)
+}
+
 // Load configuration from reader
 func Load(input io.Reader, format string) (*Config, error) {
-	c := newConfig(format)
-	// err := c.load(input)
-	err := c.loadTemplate(input)
-	if err != nil {
-		return c, err
-	}
-	return c, nil
+	return loadSource(input, "", format, "", true)
 }
 
 func (c *Config) loadTemplate(input io.Reader) error {
@@ -94,16 +124,34 @@ func (c *Config) loadTemplate(input io.Reader) error {
 	if err != nil {
 		return err
 	}
-	c.sourceTemplate, err = template.New(filepath.Base(c.configFile)).Parse(inputString.String())
+	c.sourceTemplate, err = template.New(filepath.Base(c.configFile)).Funcs(templateFuncs()).Parse(inputString.String())
 	if err != nil {
 		return fmt.Errorf("cannot compile %w", err)
 	}
+	data := newTemplateData(c.GetBaseDir(), "default", "")
+	err = c.executeTemplate(data)
+	if err != nil {
+		return err
+	}
+	// now we can load the variables and run the template again with them
+	c.variables, err = c.getVariables("")
+	if err != nil {
+		return err
+	}
+	if len(c.variables) > 0 {
+		data.Vars = c.variables
+		return c.executeTemplate(data)
+	}
+	return nil
+}
+
+func (c *Config) executeTemplate(data TemplateData) error {
 	buffer := &bytes.Buffer{}
-	err = c.sourceTemplate.Execute(buffer, newTemplateData(c.configFile, "default"))
+	err := c.sourceTemplate.Execute(buffer, data)
 	if err != nil {
 		return fmt.Errorf("cannot execute %w", err)
 	}
-	traceConfig("default", buffer.String())
+	traceConfig(data.Profile.Name, buffer.String())
 	return c.load(buffer)
 }
 
@@ -112,8 +160,14 @@ func (c *Config) load(input io.Reader) error {
 	if c.format == "conf" {
 		c.format = "toml"
 	}
+	// keep a copy of the source: viper doesn't keep the order of the sections
+	source, err := ioutil.ReadAll(input)
+	if err != nil {
+		return err
+	}
+	c.source = source
 	c.viper.SetConfigType(c.format)
-	err := c.viper.ReadConfig(input)
+	err = c.viper.ReadConfig(bytes.NewReader(source))
 	if err != nil {
 		return fmt.Errorf("cannot parse %s configuration: %w", c.format, err)
 	}
@@ -124,13 +178,18 @@ func (c *Config) reloadTemplate(data TemplateData) error {
 	if c.sourceTemplate == nil {
 		return errors.New("no available template to execute, please load it first")
 	}
-	buffer := &bytes.Buffer{}
-	err := c.sourceTemplate.Execute(buffer, data)
+	var err error
+	// variables of the profile are loaded from the previous run of the template
+	data.Vars, err = c.getVariables(data.Profile.Name)
 	if err != nil {
-		return fmt.Errorf("cannot execute %w", err)
+		return err
 	}
-	traceConfig(data.Profile.Name, buffer.String())
-	return c.load(buffer)
+	err = c.executeTemplate(data)
+	if err != nil {
+		return err
+	}
+	c.variables = data.Vars
+	return nil
 }
 
 // IsSet checks if the key contains a value
@@ -146,6 +205,14 @@ func (c *Config) GetConfigFile() string {
 	return c.configFile
 }
 
+// GetBaseDir returns the directory used to resolve the relative paths of the configuration
+func (c *Config) GetBaseDir() string {
+	if c.baseDir != "" {
+		return c.baseDir
+	}
+	return filepath.Dir(c.configFile)
+}
+
 // Get the value from the key
 func (c *Config) Get(key string) interface{} {
 	return c.viper.Get(key)
@@ -166,7 +233,9 @@ func (c *Config) GetProfileSections() map[string][]string {
 	profiles := map[string][]string{}
 	allSettings := c.AllSettings()
 	for sectionKey, sectionRawValue := range allSettings {
-		if sectionKey == constants.SectionConfigurationGlobal || sectionKey == constants.SectionConfigurationGroups {
+		if sectionKey == constants.SectionConfigurationGlobal ||
+			sectionKey == constants.SectionConfigurationGroups ||
+			sectionKey == constants.SectionConfigurationVariables {
 			continue
 		}
 		var commandList []string
@@ -274,10 +343,12 @@ func (c *Config) loadGroups() error {
 	return nil
 }
 
-// GetProfile in configuration
-func (c *Config) GetProfile(profileKey string) (*Profile, error) {
+// GetProfile in configuration.
+// The command is the restic (or resticprofile) command about to run with this profile, and it's made available to the template
+func (c *Config) GetProfile(profileKey, command string) (*Profile, error) {
+	c.currentProfile = profileKey
 	if c.sourceTemplate != nil {
-		err := c.reloadTemplate(newTemplateData(c.configFile, profileKey))
+		err := c.reloadTemplate(newTemplateData(c.GetBaseDir(), profileKey, command))
 		if err != nil {
 			return nil, err
 		}
@@ -320,12 +391,40 @@ func (c *Config) getProfile(profileKey string) (*Profile, error) {
 	return profile, nil
 }
 
-// unmarshalKey is a wrapper around viper.UnmarshalKey with the right decoder config options
+// unmarshalKey is doing the same as viper.UnmarshalKey with the right decoder config options,
+// after applying the overrides to the section
 func (c *Config) unmarshalKey(key string, rawVal interface{}) error {
+	input := c.viper.Get(key)
+	if len(c.overrides) > 0 {
+		input = c.applyOverrides(key, input, rawVal)
+	}
+	// same default configuration as viper (the hooks are set by decodeHook)
+	decoderConfig := &mapstructure.DecoderConfig{
+		Metadata:         nil,
+		Result:           rawVal,
+		WeaklyTypedInput: true,
+	}
+	c.decodeHook(c.variables)(decoderConfig)
+	decoder, err := mapstructure.NewDecoder(decoderConfig)
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(input)
+}
+
+// decodeHook returns the decoder config option for the configuration format, expanding the variables in parameter
+func (c *Config) decodeHook(variables map[string]string) viper.DecoderConfigOption {
+	hooks := make([]mapstructure.DecodeHookFunc, 0, 3)
 	if c.format == "hcl" {
-		return c.viper.UnmarshalKey(key, rawVal, configOptionHCL)
+		hooks = append(hooks, sliceOfMapsToMapHookFunc())
+	}
+	if len(variables) > 0 {
+		hooks = append(hooks, variablesHookFunc(variables))
 	}
-	return c.viper.UnmarshalKey(key, rawVal, configOption)
+	// durations like "26h" (after the variables are expanded).
+	// The other default hook of viper is not used: it would split the strings containing a comma into a list
+	hooks = append(hooks, mapstructure.StringToTimeDurationHookFunc())
+	return viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(hooks...))
 }
 
 // sliceOfMapsToMapHookFunc merges a slice of maps to a map
@@ -107,7 +107,7 @@ profile:
 			c, err := Load(bytes.NewBufferString(testConfig), format)
 			require.NoError(t, err)
 
-			profile, err := c.GetProfile("profile")
+			profile, err := c.GetProfile("profile", "")
 			require.NoError(t, err)
 
 			assert.NotNil(t, profile)
@@ -116,3 +116,36 @@ profile:
 		})
 	}
 }
+
+func TestLoadSourceWithBaseDir(t *testing.T) {
+	testConfig := `
+[profile]
+password-file = "{{ .ConfigDir }}/key"
+repository = "backup"
+`
+	c, err := LoadSource(bytes.NewBufferString(testConfig), "https://config-server/profiles", "toml", "/srv")
+	require.NoError(t, err)
+	assert.Equal(t, "/srv", c.GetBaseDir())
+
+	profile, err := c.GetProfile("profile", "")
+	require.NoError(t, err)
+	require.NotNil(t, profile)
+	assert.Equal(t, "/srv/key", profile.PasswordFile)
+}
+
+func TestReloadWithoutTemplate(t *testing.T) {
+	testConfig := `
+[profile]
+repository = "{{ .Profile.Name }}"
+`
+	c, err := LoadSource(bytes.NewBufferString(testConfig), "profiles.toml", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, ".", c.GetBaseDir())
+
+	reloaded, err := c.Reload(false)
+	require.NoError(t, err)
+	profile, err := reloaded.getProfile("profile")
+	require.NoError(t, err)
+	require.NotNil(t, profile)
+	assert.Equal(t, "{{ .Profile.Name }}", profile.Repository)
+}
@@ -0,0 +1,515 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/creativeprojects/resticprofile/constants"
+	"github.com/hashicorp/hcl/hcl/ast"
+	hclParser "github.com/hashicorp/hcl/hcl/parser"
+	"github.com/pelletier/go-toml"
+	"gopkg.in/yaml.v2"
+)
+
+// FormatHCL is only available for converting a configuration
+const FormatHCL = "hcl"
+
+var (
+	hclIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+)
+
+// section is a top level key of the configuration, with its raw value
+type section struct {
+	key   string
+	value interface{}
+}
+
+// Convert writes the configuration in the format in parameter (toml, yaml, json or hcl).
+//
+// The order of the sections (global, groups and profiles) is preserved. If the template has been executed while loading,
+// each profile is converted from the template executed for that profile.
+func (c *Config) Convert(w io.Writer, format string) error {
+	sections, err := c.getSections()
+	if err != nil {
+		return err
+	}
+	switch format {
+	case FormatJSON:
+		return encodeJSON(w, sections)
+	case FormatYAML:
+		return encodeYAML(w, sections)
+	case FormatTOML:
+		return encodeTOML(w, sections)
+	case FormatHCL:
+		return encodeHCL(w, sections)
+	}
+	return fmt.Errorf("unsupported format '%s'", format)
+}
+
+// VerifyConversion loads the converted configuration and checks the global section, the groups and all the profiles
+// are identical to the original configuration
+func VerifyConversion(original *Config, converted []byte, format string) error {
+	// the converted configuration must receive the same template data
+	target := newConfig(format)
+	target.configFile = original.configFile
+	target.baseDir = original.baseDir
+	target.overrides = original.overrides
+	err := target.loadTemplate(bytes.NewReader(converted))
+	if err != nil {
+		return fmt.Errorf("cannot load converted configuration: %w", err)
+	}
+
+	originalGlobal, err := original.GetGlobalSection()
+	if err != nil {
+		return err
+	}
+	targetGlobal, err := target.GetGlobalSection()
+	if err != nil {
+		return err
+	}
+	err = compareStructs(constants.SectionConfigurationGlobal, originalGlobal, targetGlobal)
+	if err != nil {
+		return err
+	}
+
+	if !reflect.DeepEqual(original.GetProfileGroups(), target.GetProfileGroups()) {
+		return fmt.Errorf("section '%s' is different after conversion", constants.SectionConfigurationGroups)
+	}
+
+	originalProfiles := original.getProfileNames()
+	targetProfiles := target.getProfileNames()
+	if !reflect.DeepEqual(originalProfiles, targetProfiles) {
+		return fmt.Errorf("list of profiles is different after conversion: %v instead of %v", targetProfiles, originalProfiles)
+	}
+	for _, profileName := range originalProfiles {
+		originalProfile, err := original.GetProfile(profileName, "")
+		if err != nil {
+			return err
+		}
+		targetProfile, err := target.GetProfile(profileName, "")
+		if err != nil {
+			return err
+		}
+		err = compareStructs(profileName, originalProfile, targetProfile)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getProfileNames returns the sorted list of profile names
+func (c *Config) getProfileNames() []string {
+	profiles := c.GetProfileSections()
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// compareStructs compares the configuration keys of both structs.
+// The values are compared once serialized so the numbers coming from the different formats are comparable
+func compareStructs(name string, original, target interface{}) error {
+	originalMap, err := ToMap(original, true)
+	if err != nil {
+		return err
+	}
+	targetMap, err := ToMap(target, true)
+	if err != nil {
+		return err
+	}
+	// keys are case insensitive, but some formats keep the case of the keys in sub-sections
+	originalMap = lowerKeys(originalMap)
+	targetMap = lowerKeys(targetMap)
+	keys := make([]string, 0, len(originalMap)+len(targetMap))
+	for key := range originalMap {
+		keys = append(keys, key)
+	}
+	for key := range targetMap {
+		if _, found := originalMap[key]; !found {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		originalValue, err := json.Marshal(originalMap[key])
+		if err != nil {
+			return err
+		}
+		targetValue, err := json.Marshal(targetMap[key])
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(originalValue, targetValue) {
+			return fmt.Errorf("section '%s' is different after conversion: '%s' was %s and is now %s", name, key, originalValue, targetValue)
+		}
+	}
+	return nil
+}
+
+func lowerKeys(input map[string]interface{}) map[string]interface{} {
+	output := make(map[string]interface{}, len(input))
+	for key, value := range input {
+		if subMap, ok := value.(map[string]interface{}); ok {
+			value = lowerKeys(subMap)
+		}
+		output[strings.ToLower(key)] = value
+	}
+	return output
+}
+
+// getSections returns all the top level sections, in the order of the configuration file
+func (c *Config) getSections() ([]section, error) {
+	keys, err := sectionOrder(c.format, c.source)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the order of the sections: %w", err)
+	}
+	profiles := c.GetProfileSections()
+
+	sections := make([]section, 0, len(keys))
+	for _, key := range keys {
+		if _, isProfile := profiles[key]; isProfile && c.sourceTemplate != nil {
+			// a profile can have a different configuration after executing the template for itself
+			err = c.reloadTemplate(newTemplateData(c.GetBaseDir(), key, ""))
+			if err != nil {
+				return nil, err
+			}
+		}
+		sections = append(sections, section{key: key, value: normalizeValue(c.viper.Get(key))})
+	}
+	return sections, nil
+}
+
+// sectionOrder returns the top level keys in the order of the source
+func sectionOrder(format string, source []byte) ([]string, error) {
+	var keys []string
+	var err error
+	switch format {
+	case FormatJSON:
+		keys, err = sectionOrderJSON(source)
+	case FormatYAML, "yml":
+		keys, err = sectionOrderYAML(source)
+	case FormatTOML:
+		keys, err = sectionOrderTOML(source)
+	case FormatHCL:
+		keys, err = sectionOrderHCL(source)
+	default:
+		err = fmt.Errorf("unsupported format '%s'", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// the keys are case insensitive and HCL allows duplicates
+	unique := make([]string, 0, len(keys))
+	found := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		key = strings.ToLower(key)
+		if found[key] {
+			continue
+		}
+		found[key] = true
+		unique = append(unique, key)
+	}
+	return unique, nil
+}
+
+func sectionOrderJSON(source []byte) ([]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(source))
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token != json.Delim('{') {
+		return nil, errors.New("expected a JSON object")
+	}
+	keys := make([]string, 0)
+	for decoder.More() {
+		token, err = decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, fmt.Sprint(token))
+		// skip the value
+		value := json.RawMessage{}
+		err = decoder.Decode(&value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+func sectionOrderYAML(source []byte) ([]string, error) {
+	content := yaml.MapSlice{}
+	err := yaml.Unmarshal(source, &content)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(content))
+	for i, item := range content {
+		keys[i] = fmt.Sprint(item.Key)
+	}
+	return keys, nil
+}
+
+func sectionOrderTOML(source []byte) ([]string, error) {
+	tree, err := toml.LoadBytes(source)
+	if err != nil {
+		return nil, err
+	}
+	keys := tree.Keys()
+	lines := make(map[string]int, len(keys))
+	for _, key := range keys {
+		lines[key] = tomlLine(tree, key)
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return lines[keys[i]] < lines[keys[j]]
+	})
+	return keys, nil
+}
+
+// tomlLine returns the line of the key in the source. A table which is not declared (only its sub-tables are)
+// is placed at the line of its first sub-table
+func tomlLine(tree *toml.Tree, key string) int {
+	position := tree.GetPosition(key)
+	if !position.Invalid() {
+		return position.Line
+	}
+	line := 0
+	if subTree, ok := tree.Get(key).(*toml.Tree); ok {
+		for _, subKey := range subTree.Keys() {
+			subLine := tomlLine(subTree, subKey)
+			if subLine > 0 && (line == 0 || subLine < line) {
+				line = subLine
+			}
+		}
+	}
+	return line
+}
+
+func sectionOrderHCL(source []byte) ([]string, error) {
+	file, err := hclParser.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := file.Node.(*ast.ObjectList)
+	if !ok {
+		return nil, errors.New("expected a list of objects")
+	}
+	keys := make([]string, 0, len(list.Items))
+	for _, item := range list.Items {
+		if len(item.Keys) == 0 {
+			continue
+		}
+		key, ok := item.Keys[0].Token.Value().(string)
+		if !ok {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// normalizeValue converts the values coming from the different configuration formats into
+// maps of strings and slices of interfaces
+func normalizeValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		output := make(map[string]interface{}, len(typed))
+		for key, item := range typed {
+			output[key] = normalizeValue(item)
+		}
+		return output
+
+	case map[interface{}]interface{}:
+		output := make(map[string]interface{}, len(typed))
+		for key, item := range typed {
+			output[fmt.Sprint(key)] = normalizeValue(item)
+		}
+		return output
+
+	case []map[string]interface{}:
+		// HCL blocks can be declared multiple times
+		output := make(map[string]interface{})
+		for _, mapItem := range typed {
+			for key, item := range mapItem {
+				output[key] = normalizeValue(item)
+			}
+		}
+		return output
+
+	case []interface{}:
+		output := make([]interface{}, len(typed))
+		for i, item := range typed {
+			output[i] = normalizeValue(item)
+		}
+		return output
+
+	case []string:
+		output := make([]interface{}, len(typed))
+		for i, item := range typed {
+			output[i] = item
+		}
+		return output
+	}
+	return value
+}
+
+func encodeJSON(w io.Writer, sections []section) error {
+	_, err := io.WriteString(w, "{\n")
+	if err != nil {
+		return err
+	}
+	for i, section := range sections {
+		key, err := json.Marshal(section.key)
+		if err != nil {
+			return err
+		}
+		value, err := json.MarshalIndent(section.value, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		separator := ","
+		if i == len(sections)-1 {
+			separator = ""
+		}
+		_, err = fmt.Fprintf(w, "  %s: %s%s\n", key, value, separator)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = io.WriteString(w, "}\n")
+	return err
+}
+
+func encodeYAML(w io.Writer, sections []section) error {
+	content := make(yaml.MapSlice, len(sections))
+	for i, section := range sections {
+		content[i] = yaml.MapItem{Key: section.key, Value: section.value}
+	}
+	encoder := yaml.NewEncoder(w)
+	defer encoder.Close()
+	return encoder.Encode(content)
+}
+
+func encodeTOML(w io.Writer, sections []section) error {
+	// values which are not tables have to be declared first
+	values := make(map[string]interface{})
+	for _, section := range sections {
+		if _, isTable := section.value.(map[string]interface{}); !isTable {
+			values[section.key] = section.value
+		}
+	}
+	if len(values) > 0 {
+		err := writeTOML(w, values)
+		if err != nil {
+			return err
+		}
+	}
+	for _, section := range sections {
+		if _, isTable := section.value.(map[string]interface{}); !isTable {
+			continue
+		}
+		err := writeTOML(w, map[string]interface{}{section.key: section.value})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeTOML(w io.Writer, values map[string]interface{}) error {
+	tree, err := toml.TreeFromMap(values)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, tree.String())
+	return err
+}
+
+func encodeHCL(w io.Writer, sections []section) error {
+	for _, section := range sections {
+		err := writeHCL(w, section.key, section.value, "")
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, "\n")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeHCL(w io.Writer, key string, value interface{}, indent string) error {
+	if !hclIdentifier.MatchString(key) {
+		key = strconv.Quote(key)
+	}
+	var err error
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		_, err = fmt.Fprintf(w, "%s%s {\n", indent, key)
+		if err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(typed))
+		for subKey := range typed {
+			keys = append(keys, subKey)
+		}
+		// values first, then blocks
+		sort.Slice(keys, func(i, j int) bool {
+			_, iBlock := typed[keys[i]].(map[string]interface{})
+			_, jBlock := typed[keys[j]].(map[string]interface{})
+			if iBlock != jBlock {
+				return jBlock
+			}
+			return keys[i] < keys[j]
+		})
+		for _, subKey := range keys {
+			err = writeHCL(w, subKey, typed[subKey], indent+"  ")
+			if err != nil {
+				return err
+			}
+		}
+		_, err = fmt.Fprintf(w, "%s}\n", indent)
+
+	case []interface{}:
+		items := make([]string, len(typed))
+		for i, item := range typed {
+			items[i], err = hclValue(item)
+			if err != nil {
+				return fmt.Errorf("key '%s': %w", key, err)
+			}
+		}
+		_, err = fmt.Fprintf(w, "%s%s = [%s]\n", indent, key, strings.Join(items, ", "))
+
+	default:
+		var item string
+		item, err = hclValue(value)
+		if err != nil {
+			return fmt.Errorf("key '%s': %w", key, err)
+		}
+		_, err = fmt.Fprintf(w, "%s%s = %s\n", indent, key, item)
+	}
+	return err
+}
+
+func hclValue(value interface{}) (string, error) {
+	switch typed := value.(type) {
+	case string:
+		return strconv.Quote(typed), nil
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprint(typed), nil
+	}
+	return "", fmt.Errorf("unsupported type %T", value)
+}
@@ -0,0 +1,193 @@
+package config
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var convertTestData = []testTemplate{
+	{"toml", `
+[global]
+priority = "low"
+
+[groups]
+full = ["src", "root"]
+
+[src]
+inherit = "root"
+lock = "/tmp/{{ .Profile.Name }}.lock"
+[src.backup]
+source = ["/home"]
+exclude-caches = true
+
+[root]
+repository = "/backup"
+password-file = "key"
+[root.env]
+AWS_SECRET_ACCESS_KEY = "secret"
+[root.backup]
+source = ["/"]
+one-file-system = true
+[root.retention]
+keep-daily = 7
+`},
+	{"yaml", `
+global:
+  priority: low
+groups:
+  full:
+    - src
+    - root
+src:
+  inherit: root
+  lock: "/tmp/{{ .Profile.Name }}.lock"
+  backup:
+    source:
+      - /home
+    exclude-caches: true
+root:
+  repository: /backup
+  password-file: key
+  env:
+    AWS_SECRET_ACCESS_KEY: secret
+  backup:
+    source:
+      - /
+    one-file-system: true
+  retention:
+    keep-daily: 7
+`},
+	{"json", `{
+  "global": {"priority": "low"},
+  "groups": {"full": ["src", "root"]},
+  "src": {
+    "inherit": "root",
+    "lock": "/tmp/{{ .Profile.Name }}.lock",
+    "backup": {"source": ["/home"], "exclude-caches": true}
+  },
+  "root": {
+    "repository": "/backup",
+    "password-file": "key",
+    "env": {"AWS_SECRET_ACCESS_KEY": "secret"},
+    "backup": {"source": ["/"], "one-file-system": true},
+    "retention": {"keep-daily": 7}
+  }
+}`},
+	{"hcl", `
+global {
+  priority = "low"
+}
+groups {
+  full = ["src", "root"]
+}
+src {
+  inherit = "root"
+  lock = "/tmp/{{ .Profile.Name }}.lock"
+  backup {
+    source = ["/home"]
+    exclude-caches = true
+  }
+}
+root {
+  repository = "/backup"
+  password-file = "key"
+  env {
+    AWS_SECRET_ACCESS_KEY = "secret"
+  }
+  backup {
+    source = ["/"]
+    one-file-system = true
+  }
+  retention {
+    keep-daily = 7
+  }
+}
+`},
+}
+
+func TestConvertKeepsSectionOrder(t *testing.T) {
+	for _, testItem := range convertTestData {
+		format := testItem.format
+		c := newConfig(format)
+		require.NoError(t, c.load(bytes.NewBufferString(testItem.config)))
+
+		sections, err := c.getSections()
+		require.NoError(t, err)
+		keys := make([]string, len(sections))
+		for i, section := range sections {
+			keys[i] = section.key
+		}
+		assert.Equal(t, []string{"global", "groups", "src", "root"}, keys, format)
+	}
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	for _, testItem := range convertTestData {
+		for _, target := range []string{FormatTOML, FormatYAML, FormatJSON, FormatHCL} {
+			t.Run(testItem.format+" to "+target, func(t *testing.T) {
+				original, err := Load(bytes.NewBufferString(testItem.config), testItem.format)
+				require.NoError(t, err)
+
+				source := newConfig(testItem.format)
+				require.NoError(t, source.load(bytes.NewBufferString(testItem.config)))
+				buffer := &bytes.Buffer{}
+				require.NoError(t, source.Convert(buffer, target))
+				// templates are not executed
+				assert.Contains(t, buffer.String(), "{{ .Profile.Name }}")
+
+				keys, err := sectionOrder(target, buffer.Bytes())
+				require.NoError(t, err)
+				assert.Equal(t, []string{"global", "groups", "src", "root"}, keys)
+
+				assert.NoError(t, VerifyConversion(original, buffer.Bytes(), target))
+			})
+		}
+	}
+}
+
+func TestConvertWithTemplate(t *testing.T) {
+	testConfig := `
+[root]
+repository = "/backup/{{ .Profile.Name }}"
+[src]
+inherit = "root"
+[src.backup]
+tag = ["{{ .Profile.Name }}"]
+`
+	c, err := Load(bytes.NewBufferString(testConfig), "toml")
+	require.NoError(t, err)
+
+	buffer := &bytes.Buffer{}
+	require.NoError(t, c.Convert(buffer, FormatYAML))
+	assert.Equal(t, `root:
+  repository: /backup/root
+src:
+  backup:
+    tag:
+    - src
+  inherit: root
+`, buffer.String())
+
+	// the inherited repository was generated from the template of profile 'src'
+	assert.EqualError(t, VerifyConversion(c, buffer.Bytes(), FormatYAML), `section 'src' is different after conversion: 'repository' was "/backup/src" and is now "/backup/root"`)
+}
+
+func TestVerifyConversionFailure(t *testing.T) {
+	original, err := Load(bytes.NewBufferString("[profile]\nrepository = \"/backup\"\n"), "toml")
+	require.NoError(t, err)
+
+	err = VerifyConversion(original, []byte("profile:\n  repository: /other\n"), FormatYAML)
+	assert.EqualError(t, err, `section 'profile' is different after conversion: 'repository' was "/backup" and is now "/other"`)
+
+	err = VerifyConversion(original, []byte("other:\n  repository: /backup\n"), FormatYAML)
+	assert.Error(t, err)
+}
+
+func TestConvertUnsupportedFormat(t *testing.T) {
+	c, err := Load(bytes.NewBufferString("[profile]\nrepository = \"/backup\"\n"), "toml")
+	require.NoError(t, err)
+	assert.Error(t, c.Convert(&bytes.Buffer{}, "xml"))
+}
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/creativeprojects/resticprofile/secret"
+	"github.com/pelletier/go-toml"
+	"gopkg.in/yaml.v2"
+)
+
+// Formats available to export a configuration
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatTOML = "toml"
+)
+
+// ToMap converts a configuration struct (like Global or Profile) into a map using the configuration keys.
+// Empty values are left out, and secrets are masked unless showSecrets is true
+func ToMap(orig interface{}, showSecrets bool) (map[string]interface{}, error) {
+	valueOf := reflect.ValueOf(orig)
+	if valueOf.Kind() == reflect.Ptr {
+		valueOf = valueOf.Elem()
+	}
+	if valueOf.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("unsupported type %s, expected %s", valueOf.Kind(), reflect.Struct)
+	}
+	return structToMap(valueOf, showSecrets), nil
+}
+
+func structToMap(valueOf reflect.Value, showSecrets bool) map[string]interface{} {
+	typeOf := valueOf.Type()
+	output := make(map[string]interface{})
+
+	for i := 0; i < typeOf.NumField(); i++ {
+		key, ok := typeOf.Field(i).Tag.Lookup("mapstructure")
+		if !ok || key == "" || key == "inherit" {
+			continue
+		}
+		field := valueOf.Field(i)
+		// special case of the map of remaining parameters: they're added at the same level
+		if key == ",remain" {
+			if field.Kind() == reflect.Map {
+				iter := field.MapRange()
+				for iter.Next() {
+					addToMap(output, iter.Key().String(), iter.Value(), showSecrets)
+				}
+			}
+			continue
+		}
+		addToMap(output, key, field, showSecrets)
+	}
+	return output
+}
+
+func addToMap(output map[string]interface{}, key string, valueOf reflect.Value, showSecrets bool) {
+	value, ok := exportValue(valueOf, showSecrets)
+	if !ok {
+		return
+	}
+	if !showSecrets && secret.IsSensitiveKey(key) {
+		value = maskValue(value)
+	}
+	output[key] = value
+}
+
+// exportValue returns a plain value ready for serialization, and false if the value is empty
+func exportValue(valueOf reflect.Value, showSecrets bool) (interface{}, bool) {
+	if valueOf.Type() == durationType {
+		duration := time.Duration(valueOf.Int())
+		return duration.String(), duration != 0
+	}
+	switch valueOf.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if valueOf.IsNil() {
+			return nil, false
+		}
+		return exportValue(valueOf.Elem(), showSecrets)
+
+	case reflect.Struct:
+		value := structToMap(valueOf, showSecrets)
+		return value, len(value) > 0
+
+	case reflect.Map:
+		if valueOf.Len() == 0 {
+			return nil, false
+		}
+		value := make(map[string]interface{}, valueOf.Len())
+		iter := valueOf.MapRange()
+		for iter.Next() {
+			addToMap(value, iter.Key().String(), iter.Value(), showSecrets)
+		}
+		return value, len(value) > 0
+
+	case reflect.Slice, reflect.Array:
+		if valueOf.Len() == 0 {
+			return nil, false
+		}
+		value := make([]interface{}, 0, valueOf.Len())
+		for i := 0; i < valueOf.Len(); i++ {
+			if item, ok := exportValue(valueOf.Index(i), showSecrets); ok {
+				value = append(value, item)
+			}
+		}
+		return value, len(value) > 0
+
+	case reflect.String:
+		return valueOf.String(), valueOf.String() != ""
+
+	case reflect.Bool:
+		return valueOf.Bool(), valueOf.Bool()
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return valueOf.Int(), valueOf.Int() != 0
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return valueOf.Uint(), valueOf.Uint() != 0
+
+	case reflect.Float32, reflect.Float64:
+		return valueOf.Float(), valueOf.Float() != 0
+	}
+	return nil, false
+}
+
+func maskValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case string:
+		return secret.Mask(typed)
+	case []interface{}:
+		masked := make([]interface{}, len(typed))
+		for i, item := range typed {
+			masked[i] = maskValue(item)
+		}
+		return masked
+	}
+	return value
+}
+
+// Encode writes the data in the format in parameter (json, yaml or toml)
+func Encode(w io.Writer, format string, data map[string]interface{}) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(data)
+
+	case FormatYAML:
+		encoder := yaml.NewEncoder(w)
+		defer encoder.Close()
+		return encoder.Encode(data)
+
+	case FormatTOML:
+		tree, err := toml.TreeFromMap(data)
+		if err != nil {
+			return err
+		}
+		_, err = tree.WriteTo(w)
+		return err
+	}
+	return fmt.Errorf("unsupported format '%s'", format)
+}
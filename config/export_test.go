@@ -0,0 +1,109 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/pelletier/go-toml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestToMap(t *testing.T) {
+	input := testObject{
+		Id:     11,
+		Person: testPerson{Name: "test", Properties: map[string][]string{"list": {"one", "two"}}},
+		Map:    map[string][]string{"left": {"over"}, "empty": {}},
+	}
+	output, err := ToMap(input, false)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"id": int64(11),
+		"person": map[string]interface{}{
+			"name":       "test",
+			"properties": map[string]interface{}{"list": []interface{}{"one", "two"}},
+		},
+		"left": []interface{}{"over"},
+	}, output)
+}
+
+func TestToMapUnsupportedType(t *testing.T) {
+	_, err := ToMap("string", false)
+	assert.Error(t, err)
+}
+
+func TestToMapMasksSecrets(t *testing.T) {
+	profile := &Profile{
+		Name:         "profile",
+		Repository:   "/backup",
+		Password:     "my password",
+		PasswordFile: "key",
+		Environment: map[string]string{
+			"aws_secret_access_key": "secret",
+			"restic_password":       "env:BACKUP_PASSWORD",
+		},
+		Backup: &BackupSection{
+			OtherFlags: map[string]interface{}{"password": "inline"},
+		},
+	}
+	output, err := ToMap(profile, false)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"repository":    "/backup",
+		"password":      "***",
+		"password-file": "key",
+		"env": map[string]interface{}{
+			"aws_secret_access_key": "***",
+			"restic_password":       "env:BACKUP_PASSWORD",
+		},
+		"backup": map[string]interface{}{
+			"password": "***",
+		},
+	}, output)
+
+	output, err = ToMap(profile, true)
+	require.NoError(t, err)
+	assert.Equal(t, "my password", output["password"])
+	assert.Equal(t, "secret", output["env"].(map[string]interface{})["aws_secret_access_key"])
+}
+
+func TestEncode(t *testing.T) {
+	data := map[string]interface{}{
+		"profile": map[string]interface{}{
+			"repository": "/backup",
+			"backup": map[string]interface{}{
+				"source": []interface{}{"/home", "/etc"},
+			},
+		},
+	}
+
+	t.Run(FormatJSON, func(t *testing.T) {
+		buffer := &bytes.Buffer{}
+		require.NoError(t, Encode(buffer, FormatJSON, data))
+		decoded := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(buffer.Bytes(), &decoded))
+		assert.Equal(t, data, decoded)
+	})
+
+	t.Run(FormatYAML, func(t *testing.T) {
+		buffer := &bytes.Buffer{}
+		require.NoError(t, Encode(buffer, FormatYAML, data))
+		decoded := map[string]interface{}{}
+		require.NoError(t, yaml.Unmarshal(buffer.Bytes(), &decoded))
+		assert.Equal(t, "/backup", decoded["profile"].(map[interface{}]interface{})["repository"])
+	})
+
+	t.Run(FormatTOML, func(t *testing.T) {
+		buffer := &bytes.Buffer{}
+		require.NoError(t, Encode(buffer, FormatTOML, data))
+		tree, err := toml.LoadBytes(buffer.Bytes())
+		require.NoError(t, err)
+		assert.Equal(t, data, tree.ToMap())
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		assert.Error(t, Encode(&bytes.Buffer{}, "xml", data))
+	})
+}
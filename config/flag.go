@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"reflect"
 	"strconv"
+	"time"
 )
 
 var (
 	emptyStringArray []string
+	durationType     = reflect.TypeOf(time.Duration(0))
 )
 
 func init() {
@@ -53,6 +55,11 @@ func stringifyValueOf(value interface{}) ([]string, bool) {
 
 // stringifyValue returns a string representation of the value, and if it has any value at all
 func stringifyValue(value reflect.Value) ([]string, bool) {
+	// durations are more readable with their units
+	if value.Type() == durationType {
+		duration := time.Duration(value.Int())
+		return []string{duration.String()}, duration != 0
+	}
 
 	switch value.Kind() {
 	case reflect.String:
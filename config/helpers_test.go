@@ -25,7 +25,7 @@ func getResolvedProfile(configFormat, configString, profileKey string) (*Profile
 		return nil, err
 	}
 
-	profile, err := c.GetProfile(profileKey)
+	profile, err := c.GetProfile(profileKey, "")
 	if err != nil {
 		return nil, err
 	}
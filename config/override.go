@@ -0,0 +1,264 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/creativeprojects/clog"
+	"github.com/creativeprojects/resticprofile/constants"
+)
+
+const (
+	envOverrideSeparator = "__"
+)
+
+// override is a value replacing (or adding) a key of the configuration, from outside the configuration file.
+// An empty section means the override applies to the profile being loaded
+type override struct {
+	section string
+	path    []string
+	value   string
+	origin  string
+	// appendList adds the value to the list set by a previous flag on the same key, instead of replacing it
+	appendList bool
+}
+
+// AddEnvironmentOverrides loads the overrides from the environment variables like RESTICPROFILE_<SECTION>__<KEY>.
+//
+// The section is either a profile name or GLOBAL. Nested keys are separated with a double underscore,
+// and a single underscore is replaced by a dash, so RESTICPROFILE_NAS__BACKUP__EXCLUDE_CACHES
+// overrides the key "exclude-caches" of the "backup" section in profile "nas"
+func (c *Config) AddEnvironmentOverrides(environ []string) {
+	for _, keyValue := range environ {
+		if !strings.HasPrefix(keyValue, constants.EnvOverridePrefix) {
+			continue
+		}
+		keyValueSplit := strings.SplitN(keyValue, "=", 2)
+		if len(keyValueSplit) != 2 {
+			continue
+		}
+		name := keyValueSplit[0]
+		parts := strings.Split(strings.TrimPrefix(name, constants.EnvOverridePrefix), envOverrideSeparator)
+		if len(parts) < 2 || parts[0] == "" {
+			clog.Debugf("ignoring environment variable %s: expected %s<SECTION>%s<KEY>", name, constants.EnvOverridePrefix, envOverrideSeparator)
+			continue
+		}
+		path := make([]string, len(parts)-1)
+		keepUnderscores := false
+		for i, part := range parts[1:] {
+			part = strings.ToLower(part)
+			if !keepUnderscores {
+				part = strings.ReplaceAll(part, "_", "-")
+			}
+			// the names of environment variables and variables can contain underscores
+			keepUnderscores = part == constants.SectionConfigurationEnvironment || part == constants.SectionConfigurationVariables
+			path[i] = part
+		}
+		c.overrides = append(c.overrides, override{
+			section: strings.ToLower(parts[0]),
+			path:    path,
+			value:   keyValueSplit[1],
+			origin:  "environment variable " + name,
+		})
+	}
+}
+
+// AddCommandLineOverrides loads the overrides from the "--set key=value" flags.
+//
+// The key is relative to the profile being loaded (like "repository" or "backup.tag"), unless it starts with "global.".
+// Repeating a key expecting a list (or a restic flag) adds the values to the list; for any other key, the last value wins
+func (c *Config) AddCommandLineOverrides(values []string) error {
+	flagsStart := len(c.overrides)
+	for _, keyValue := range values {
+		keyValueSplit := strings.SplitN(keyValue, "=", 2)
+		if len(keyValueSplit) != 2 || strings.TrimSpace(keyValueSplit[0]) == "" {
+			return fmt.Errorf("invalid value '%s': expected key=value", keyValue)
+		}
+		path := strings.Split(strings.ToLower(strings.TrimSpace(keyValueSplit[0])), c.keyDelim)
+		for _, part := range path {
+			if part == "" {
+				return fmt.Errorf("invalid key '%s'", keyValueSplit[0])
+			}
+		}
+		section := ""
+		if path[0] == constants.SectionConfigurationGlobal {
+			if len(path) < 2 {
+				return fmt.Errorf("invalid key '%s'", keyValueSplit[0])
+			}
+			section = constants.SectionConfigurationGlobal
+			path = path[1:]
+		}
+		c.overrides = append(c.overrides, override{
+			section:    section,
+			path:       path,
+			value:      keyValueSplit[1],
+			origin:     "command line flag --set " + keyValueSplit[0],
+			appendList: hasOverride(c.overrides[flagsStart:], section, path),
+		})
+	}
+	return nil
+}
+
+// GetOverrides returns a description of the overrides applied to the global section and the profile
+func (c *Config) GetOverrides(profileName string) []string {
+	descriptions := make([]string, 0)
+	for _, override := range c.overrides {
+		section := override.section
+		if sameSection(section, constants.SectionConfigurationGlobal) {
+			section = constants.SectionConfigurationGlobal
+		} else if section == "" || sameSection(section, profileName) {
+			section = profileName
+		} else {
+			continue
+		}
+		descriptions = append(descriptions, fmt.Sprintf("%s.%s: %s", section, strings.Join(override.path, "."), override.origin))
+	}
+	sort.Strings(descriptions)
+	return descriptions
+}
+
+// applyOverrides returns the raw configuration of the section with all the overrides applied.
+// The target is the struct receiving the configuration, to know which keys are expecting a list
+func (c *Config) applyOverrides(sectionKey string, input interface{}, target interface{}) interface{} {
+	output := input
+	for _, override := range c.overrides {
+		if !sameSection(override.section, sectionKey) && !(override.section == "" && sectionKey == c.currentProfile) {
+			continue
+		}
+		clog.Debugf("overriding %s.%s from %s", sectionKey, strings.Join(override.path, "."), override.origin)
+		output = setOverride(output, override.path, override.value, override.appendList, reflect.TypeOf(target))
+	}
+	return output
+}
+
+// hasOverride returns true when one of the overrides is setting the same key
+func hasOverride(overrides []override, section string, path []string) bool {
+	for _, override := range overrides {
+		if override.section == section && strings.Join(override.path, ".") == strings.Join(path, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// sameSection compares the names ignoring the case, and dashes with underscores
+func sameSection(section, key string) bool {
+	return strings.EqualFold(strings.ReplaceAll(section, "-", "_"), strings.ReplaceAll(key, "-", "_"))
+}
+
+// setOverride sets the value at the path. The maps from the configuration are copied, not modified
+func setOverride(data interface{}, path []string, value string, appendList bool, typeOf reflect.Type) interface{} {
+	output := copyMap(data)
+	// keys are case insensitive
+	key := path[0]
+	for existingKey := range output {
+		if strings.EqualFold(existingKey, key) {
+			key = existingKey
+			break
+		}
+	}
+	fieldType := getFieldType(typeOf, path[0])
+	if len(path) > 1 {
+		output[key] = setOverride(output[key], path[1:], value, appendList, fieldType)
+		return output
+	}
+	converted := convertOverride(value, output[key], fieldType)
+	if appendList && (fieldType == nil || fieldType.Kind() == reflect.Slice) {
+		converted = append(toList(output[key]), toList(converted)...)
+	}
+	output[key] = converted
+	return output
+}
+
+// copyMap returns a copy of the first level of the map (also merging the slice of maps coming from HCL)
+func copyMap(data interface{}) map[string]interface{} {
+	output := make(map[string]interface{})
+	switch typed := data.(type) {
+	case map[string]interface{}:
+		for key, value := range typed {
+			output[key] = value
+		}
+	case map[interface{}]interface{}:
+		for key, value := range typed {
+			output[fmt.Sprint(key)] = value
+		}
+	case []map[string]interface{}:
+		for _, mapItem := range typed {
+			for key, value := range mapItem {
+				output[key] = value
+			}
+		}
+	}
+	return output
+}
+
+// getFieldType returns the type receiving the key, or nil if it's unknown
+func getFieldType(typeOf reflect.Type, key string) reflect.Type {
+	if typeOf == nil {
+		return nil
+	}
+	for typeOf.Kind() == reflect.Ptr {
+		typeOf = typeOf.Elem()
+	}
+	switch typeOf.Kind() {
+	case reflect.Map:
+		return typeOf.Elem()
+	case reflect.Struct:
+		for i := 0; i < typeOf.NumField(); i++ {
+			tag := strings.Split(typeOf.Field(i).Tag.Get("mapstructure"), ",")[0]
+			if tag != "" && strings.EqualFold(tag, key) {
+				return typeOf.Field(i).Type
+			}
+		}
+	}
+	return nil
+}
+
+// convertOverride converts the value into a list when the key is expecting one.
+// When the type of the key is unknown (like a restic flag), it's guessed from the existing value
+func convertOverride(value string, existing interface{}, typeOf reflect.Type) interface{} {
+	if typeOf != nil {
+		if typeOf.Kind() == reflect.Slice {
+			return splitList(value)
+		}
+		// the conversion of the other types is done when decoding
+		return value
+	}
+	if existing != nil && reflect.TypeOf(existing).Kind() == reflect.Slice {
+		return splitList(value)
+	}
+	if value == "true" || value == "false" {
+		return value == "true"
+	}
+	if intValue, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return intValue
+	}
+	return value
+}
+
+// toList returns a copy of the value as a list (a single value becomes a list of one item)
+func toList(value interface{}) []interface{} {
+	switch typed := value.(type) {
+	case nil:
+		return []interface{}{}
+	case []interface{}:
+		return append([]interface{}{}, typed...)
+	}
+	return []interface{}{value}
+}
+
+// splitList splits a comma separated list
+func splitList(value string) []interface{} {
+	if value == "" {
+		return []interface{}{}
+	}
+	items := strings.Split(value, ",")
+	list := make([]interface{}, len(items))
+	for i, item := range items {
+		list[i] = strings.TrimSpace(item)
+	}
+	return list
+}
@@ -0,0 +1,266 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvironmentOverrides(t *testing.T) {
+	testData := []testTemplate{
+		{"toml", `
+[global]
+priority = "low"
+[my-nas]
+repository = "/backup"
+[my-nas.env]
+USER = "me"
+[my-nas.backup]
+source = "/home"
+tag = ["one"]
+`},
+		{"yaml", `
+global:
+  priority: low
+my-nas:
+  repository: /backup
+  env:
+    USER: me
+  backup:
+    source: /home
+    tag: [one]
+`},
+		{"json", `
+{
+  "global": {"priority": "low"},
+  "my-nas": {
+    "repository": "/backup",
+    "env": {"USER": "me"},
+    "backup": {"source": "/home", "tag": ["one"]}
+  }
+}`},
+		{"hcl", `
+global {
+  priority = "low"
+}
+my-nas {
+  repository = "/backup"
+  env {
+    USER = "me"
+  }
+  backup {
+    source = "/home"
+    tag = ["one"]
+  }
+}
+`},
+	}
+
+	environ := []string{
+		"HOME=/home/me",
+		"RESTICPROFILE_GLOBAL__PRIORITY=background",
+		"RESTICPROFILE_GLOBAL__INITIALIZE=true",
+		"RESTICPROFILE_MY_NAS__REPOSITORY=/override",
+		"RESTICPROFILE_MY_NAS__PASSWORD_FILE=key",
+		"RESTICPROFILE_MY_NAS__ENV__USER=you",
+		"RESTICPROFILE_MY_NAS__ENV__AWS_ACCESS_KEY_ID=id",
+		"RESTICPROFILE_MY_NAS__BACKUP__SOURCE=/home, /etc",
+		"RESTICPROFILE_MY_NAS__BACKUP__EXCLUDE_CACHES=true",
+		"RESTICPROFILE_MY_NAS__BACKUP__TAG=two,three",
+		"RESTICPROFILE_MY_NAS__BACKUP__HOST=laptop",
+		"RESTICPROFILE_MY_NAS__RETENTION__KEEP_DAILY=7",
+		"RESTICPROFILE_OTHER__REPOSITORY=/other",
+		"RESTICPROFILE_INVALID=value",
+	}
+
+	for _, testItem := range testData {
+		format := testItem.format
+		t.Run(format, func(t *testing.T) {
+			c, err := Load(bytes.NewBufferString(testItem.config), format)
+			require.NoError(t, err)
+			c.AddEnvironmentOverrides(environ)
+
+			global, err := c.GetGlobalSection()
+			require.NoError(t, err)
+			assert.Equal(t, "background", global.Priority)
+			assert.True(t, global.Initialize)
+
+			profile, err := c.GetProfile("my-nas", "")
+			require.NoError(t, err)
+			require.NotNil(t, profile)
+			assert.Equal(t, "/override", profile.Repository)
+			assert.Equal(t, "key", profile.PasswordFile)
+			assert.Len(t, profile.Environment, 2)
+			assert.Equal(t, "you", profile.Environment[findKey(profile.Environment, "user")])
+			assert.Equal(t, "id", profile.Environment["aws_access_key_id"])
+
+			require.NotNil(t, profile.Backup)
+			assert.Equal(t, []string{"/home", "/etc"}, profile.Backup.Source)
+			assert.Equal(t, true, profile.Backup.OtherFlags["exclude-caches"])
+			assert.Equal(t, []interface{}{"two", "three"}, profile.Backup.OtherFlags["tag"])
+			assert.Equal(t, "laptop", profile.Backup.OtherFlags["host"])
+			require.NotNil(t, profile.Retention)
+			assert.Equal(t, int64(7), profile.Retention.OtherFlags["keep-daily"])
+
+			// the profile doesn't exist in the configuration file
+			profile, err = c.GetProfile("other", "")
+			require.NoError(t, err)
+			assert.Nil(t, profile)
+
+			assert.Contains(t, c.GetOverrides("my-nas"), "global.priority: environment variable RESTICPROFILE_GLOBAL__PRIORITY")
+			assert.Contains(t, c.GetOverrides("my-nas"), "my-nas.backup.exclude-caches: environment variable RESTICPROFILE_MY_NAS__BACKUP__EXCLUDE_CACHES")
+			assert.Len(t, c.GetOverrides("my-nas"), 11)
+		})
+	}
+}
+
+func TestOverrideOnInheritedProfile(t *testing.T) {
+	testConfig := `
+[parent]
+repository = "/parent"
+password-file = "key"
+[child]
+inherit = "parent"
+repository = "/child"
+`
+	c, err := Load(bytes.NewBufferString(testConfig), "toml")
+	require.NoError(t, err)
+	c.AddEnvironmentOverrides([]string{
+		"RESTICPROFILE_PARENT__PASSWORD_FILE=other-key",
+		"RESTICPROFILE_PARENT__REPOSITORY=/override",
+	})
+
+	profile, err := c.GetProfile("child", "")
+	require.NoError(t, err)
+	require.NotNil(t, profile)
+	assert.Equal(t, "/child", profile.Repository)
+	assert.Equal(t, "other-key", profile.PasswordFile)
+}
+
+func TestOverrideDoesNotChangeConfiguration(t *testing.T) {
+	c, err := Load(bytes.NewBufferString("[profile]\nrepository = \"/backup\"\n"), "toml")
+	require.NoError(t, err)
+	c.AddEnvironmentOverrides([]string{"RESTICPROFILE_PROFILE__REPOSITORY=/override"})
+
+	profile, err := c.GetProfile("profile", "")
+	require.NoError(t, err)
+	assert.Equal(t, "/override", profile.Repository)
+	assert.Equal(t, "/backup", c.Get("profile").(map[string]interface{})["repository"])
+}
+
+// findKey returns the key in the map, ignoring the case
+func findKey(values map[string]string, search string) string {
+	for key := range values {
+		if strings.EqualFold(key, search) {
+			return key
+		}
+	}
+	return search
+}
+
+func TestCommandLineOverrides(t *testing.T) {
+	testConfig := `
+[global]
+priority = "low"
+[groups]
+both = ["first", "second"]
+[first]
+repository = "/first"
+[first.backup]
+tag = ["one"]
+[second]
+repository = "/second"
+`
+	c, err := Load(bytes.NewBufferString(testConfig), "toml")
+	require.NoError(t, err)
+	c.AddEnvironmentOverrides([]string{"RESTICPROFILE_FIRST__REPOSITORY=/environment"})
+	err = c.AddCommandLineOverrides([]string{
+		"global.priority=background",
+		"repository=/override",
+		"backup.tag=manual",
+		"backup.source=/home,/etc",
+		"backup.check-before=true",
+	})
+	require.NoError(t, err)
+
+	global, err := c.GetGlobalSection()
+	require.NoError(t, err)
+	assert.Equal(t, "background", global.Priority)
+
+	// the command line is applied after the environment variables
+	for _, profileName := range []string{"first", "second"} {
+		profile, err := c.GetProfile(profileName, "")
+		require.NoError(t, err)
+		require.NotNil(t, profile)
+		assert.Equal(t, "/override", profile.Repository)
+		require.NotNil(t, profile.Backup)
+		assert.Equal(t, []string{"/home", "/etc"}, profile.Backup.Source)
+		assert.True(t, profile.Backup.CheckBefore)
+		if profileName == "first" {
+			// tag is a list in the configuration file
+			assert.Equal(t, []interface{}{"manual"}, profile.Backup.OtherFlags["tag"])
+		} else {
+			assert.Equal(t, "manual", profile.Backup.OtherFlags["tag"])
+		}
+	}
+
+	assert.Equal(t, []string{
+		"first.backup.check-before: command line flag --set backup.check-before",
+		"first.backup.source: command line flag --set backup.source",
+		"first.backup.tag: command line flag --set backup.tag",
+		"first.repository: command line flag --set repository",
+		"first.repository: environment variable RESTICPROFILE_FIRST__REPOSITORY",
+		"global.priority: command line flag --set global.priority",
+	}, c.GetOverrides("first"))
+}
+
+func TestRepeatedCommandLineOverrides(t *testing.T) {
+	testConfig := `
+[first]
+repository = "/first"
+[first.backup]
+tag = ["one"]
+source = ["/source"]
+`
+	c, err := Load(bytes.NewBufferString(testConfig), "toml")
+	require.NoError(t, err)
+	err = c.AddCommandLineOverrides([]string{
+		"repository=/override",
+		"repository=/last",
+		"backup.tag=manual",
+		"backup.tag=weekly,monthly",
+		"backup.source=/home",
+		"backup.source=/etc",
+		"backup.host=one",
+		"backup.host=two",
+	})
+	require.NoError(t, err)
+
+	profile, err := c.GetProfile("first", "")
+	require.NoError(t, err)
+	require.NotNil(t, profile)
+	require.NotNil(t, profile.Backup)
+	// the last value wins for a key which is not a list
+	assert.Equal(t, "/last", profile.Repository)
+	// the values of a repeated list replace the configuration file, and are added to each other
+	assert.Equal(t, []string{"/home", "/etc"}, profile.Backup.Source)
+	assert.Equal(t, []interface{}{"manual", "weekly", "monthly"}, profile.Backup.OtherFlags["tag"])
+	// a restic flag repeated on the command line becomes a list
+	assert.Equal(t, []interface{}{"one", "two"}, profile.Backup.OtherFlags["host"])
+}
+
+func TestInvalidCommandLineOverrides(t *testing.T) {
+	testData := []string{
+		"repository",
+		"=value",
+		"backup..tag=value",
+		"global=value",
+	}
+	for _, testItem := range testData {
+		c := newConfig("toml")
+		assert.Error(t, c.AddCommandLineOverrides([]string{testItem}), testItem)
+	}
+}
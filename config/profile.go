@@ -1,53 +1,80 @@
 package config
 
 import (
+	"strings"
+	"time"
+
 	"github.com/creativeprojects/clog"
 	"github.com/creativeprojects/resticprofile/constants"
+	"github.com/creativeprojects/resticprofile/secret"
 )
 
 // Profile contains the whole profile configuration
 type Profile struct {
-	config        *Config
-	Name          string
-	Quiet         bool                      `mapstructure:"quiet" argument:"quiet"`
-	Verbose       bool                      `mapstructure:"verbose" argument:"verbose"`
-	Repository    string                    `mapstructure:"repository" argument:"repo"`
-	PasswordFile  string                    `mapstructure:"password-file" argument:"password-file"`
-	CacheDir      string                    `mapstructure:"cache-dir" argument:"cache-dir"`
-	CACert        string                    `mapstructure:"cacert" argument:"cacert"`
-	TLSClientCert string                    `mapstructure:"tls-client-cert" argument:"tls-client-cert"`
-	Initialize    bool                      `mapstructure:"initialize"`
-	Inherit       string                    `mapstructure:"inherit"`
-	Lock          string                    `mapstructure:"lock"`
-	ForceLock     bool                      `mapstructure:"force-inactive-lock"`
-	RunBefore     []string                  `mapstructure:"run-before"`
-	RunAfter      []string                  `mapstructure:"run-after"`
-	RunAfterFail  []string                  `mapstructure:"run-after-fail"`
-	StatusFile    string                    `mapstructure:"status-file"`
-	Environment   map[string]string         `mapstructure:"env"`
-	Backup        *BackupSection            `mapstructure:"backup"`
-	Retention     *RetentionSection         `mapstructure:"retention"`
-	Check         *OtherSectionWithSchedule `mapstructure:"check"`
-	Snapshots     map[string]interface{}    `mapstructure:"snapshots"`
-	Forget        map[string]interface{}    `mapstructure:"forget"`
-	Mount         map[string]interface{}    `mapstructure:"mount"`
-	OtherFlags    map[string]interface{}    `mapstructure:",remain"`
+	config              *Config
+	Name                string
+	Quiet               bool                      `mapstructure:"quiet" argument:"quiet"`
+	Verbose             bool                      `mapstructure:"verbose" argument:"verbose"`
+	Repository          string                    `mapstructure:"repository" argument:"repo"`
+	PasswordFile        string                    `mapstructure:"password-file" argument:"password-file"`
+	Password            string                    `mapstructure:"password"`
+	CacheDir            string                    `mapstructure:"cache-dir" argument:"cache-dir"`
+	CACert              string                    `mapstructure:"cacert" argument:"cacert"`
+	TLSClientCert       string                    `mapstructure:"tls-client-cert" argument:"tls-client-cert"`
+	Initialize          bool                      `mapstructure:"initialize"`
+	Inherit             string                    `mapstructure:"inherit"`
+	Lock                string                    `mapstructure:"lock"`
+	ForceLock           bool                      `mapstructure:"force-inactive-lock"`
+	RunBefore           []string                  `mapstructure:"run-before"`
+	RunAfter            []string                  `mapstructure:"run-after"`
+	RunAfterFail        []string                  `mapstructure:"run-after-fail"`
+	RunFinally          []string                  `mapstructure:"run-finally"`
+	Timeout             time.Duration             `mapstructure:"timeout"`
+	RunBeforeTimeout    time.Duration             `mapstructure:"run-before-timeout"`
+	RunAfterTimeout     time.Duration             `mapstructure:"run-after-timeout"`
+	RunAfterFailTimeout time.Duration             `mapstructure:"run-after-fail-timeout"`
+	RunFinallyTimeout   time.Duration             `mapstructure:"run-finally-timeout"`
+	StatusFile          string                    `mapstructure:"status-file"`
+	HistoryFile         string                    `mapstructure:"history-file"`
+	HistoryMaxAge       time.Duration             `mapstructure:"history-retention"`
+	Retry               *RetrySection             `mapstructure:"retry"`
+	Variables           map[string]string         `mapstructure:"variables"`
+	Environment         map[string]string         `mapstructure:"env"`
+	EnvFiles            []string                  `mapstructure:"env-file"`
+	Backup              *BackupSection            `mapstructure:"backup"`
+	Retention           *RetentionSection         `mapstructure:"retention"`
+	Check               *OtherSectionWithSchedule `mapstructure:"check"`
+	Snapshots           *OtherSection             `mapstructure:"snapshots"`
+	Forget              *OtherSection             `mapstructure:"forget"`
+	Mount               *OtherSection             `mapstructure:"mount"`
+	Prune               *OtherSection             `mapstructure:"prune"`
+	Copy                *OtherSection             `mapstructure:"copy"`
+	OtherFlags          map[string]interface{}    `mapstructure:",remain"`
 }
 
 // BackupSection contains the specific configuration to the 'backup' command
 type BackupSection struct {
-	CheckBefore        bool                   `mapstructure:"check-before"`
-	CheckAfter         bool                   `mapstructure:"check-after"`
-	RunBefore          []string               `mapstructure:"run-before"`
-	RunAfter           []string               `mapstructure:"run-after"`
-	UseStdin           bool                   `mapstructure:"stdin" argument:"stdin"`
-	Source             []string               `mapstructure:"source"`
-	ExcludeFile        []string               `mapstructure:"exclude-file" argument:"exclude-file"`
-	FilesFrom          []string               `mapstructure:"files-from" argument:"files-from"`
-	Schedule           []string               `mapstructure:"schedule"`
-	SchedulePermission string                 `mapstructure:"schedule-permission"`
-	ScheduleLog        string                 `mapstructure:"schedule-log"`
-	OtherFlags         map[string]interface{} `mapstructure:",remain"`
+	CheckBefore         bool                   `mapstructure:"check-before"`
+	CheckAfter          bool                   `mapstructure:"check-after"`
+	RunBefore           []string               `mapstructure:"run-before"`
+	RunAfter            []string               `mapstructure:"run-after"`
+	RunAfterFail        []string               `mapstructure:"run-after-fail"`
+	RunFinally          []string               `mapstructure:"run-finally"`
+	Timeout             time.Duration          `mapstructure:"timeout"`
+	RunBeforeTimeout    time.Duration          `mapstructure:"run-before-timeout"`
+	RunAfterTimeout     time.Duration          `mapstructure:"run-after-timeout"`
+	RunAfterFailTimeout time.Duration          `mapstructure:"run-after-fail-timeout"`
+	RunFinallyTimeout   time.Duration          `mapstructure:"run-finally-timeout"`
+	UseStdin            bool                   `mapstructure:"stdin" argument:"stdin"`
+	Source              []string               `mapstructure:"source"`
+	ExcludeFile         []string               `mapstructure:"exclude-file" argument:"exclude-file"`
+	FilesFrom           []string               `mapstructure:"files-from" argument:"files-from"`
+	Schedule            []string               `mapstructure:"schedule"`
+	SchedulePermission  string                 `mapstructure:"schedule-permission"`
+	ScheduleLog         string                 `mapstructure:"schedule-log"`
+	MaxAge              time.Duration          `mapstructure:"max-age"`
+	Retry               *RetrySection          `mapstructure:"retry"`
+	OtherFlags          map[string]interface{} `mapstructure:",remain"`
 }
 
 // RetentionSection contains the specific configuration to
@@ -58,16 +85,69 @@ type RetentionSection struct {
 	Schedule           []string               `mapstructure:"schedule"`
 	SchedulePermission string                 `mapstructure:"schedule-permission"`
 	ScheduleLog        string                 `mapstructure:"schedule-log"`
+	MaxAge             time.Duration          `mapstructure:"max-age"`
+	Retry              *RetrySection          `mapstructure:"retry"`
+	Timeout            time.Duration          `mapstructure:"timeout"`
 	OtherFlags         map[string]interface{} `mapstructure:",remain"`
 }
 
 // OtherSectionWithSchedule is a section containing schedule only specific parameters
 // (the other parameters being for restic)
 type OtherSectionWithSchedule struct {
-	Schedule           []string               `mapstructure:"schedule"`
-	SchedulePermission string                 `mapstructure:"schedule-permission"`
-	ScheduleLog        string                 `mapstructure:"schedule-log"`
-	OtherFlags         map[string]interface{} `mapstructure:",remain"`
+	Schedule            []string               `mapstructure:"schedule"`
+	SchedulePermission  string                 `mapstructure:"schedule-permission"`
+	ScheduleLog         string                 `mapstructure:"schedule-log"`
+	MaxAge              time.Duration          `mapstructure:"max-age"`
+	Retry               *RetrySection          `mapstructure:"retry"`
+	RunBefore           []string               `mapstructure:"run-before"`
+	RunAfter            []string               `mapstructure:"run-after"`
+	RunAfterFail        []string               `mapstructure:"run-after-fail"`
+	RunFinally          []string               `mapstructure:"run-finally"`
+	Timeout             time.Duration          `mapstructure:"timeout"`
+	RunBeforeTimeout    time.Duration          `mapstructure:"run-before-timeout"`
+	RunAfterTimeout     time.Duration          `mapstructure:"run-after-timeout"`
+	RunAfterFailTimeout time.Duration          `mapstructure:"run-after-fail-timeout"`
+	RunFinallyTimeout   time.Duration          `mapstructure:"run-finally-timeout"`
+	OtherFlags          map[string]interface{} `mapstructure:",remain"`
+}
+
+// OtherSection is a section containing the commands to run before and after restic only
+// (the other parameters being for restic)
+type OtherSection struct {
+	MaxAge              time.Duration          `mapstructure:"max-age"`
+	Retry               *RetrySection          `mapstructure:"retry"`
+	RunBefore           []string               `mapstructure:"run-before"`
+	RunAfter            []string               `mapstructure:"run-after"`
+	RunAfterFail        []string               `mapstructure:"run-after-fail"`
+	RunFinally          []string               `mapstructure:"run-finally"`
+	Timeout             time.Duration          `mapstructure:"timeout"`
+	RunBeforeTimeout    time.Duration          `mapstructure:"run-before-timeout"`
+	RunAfterTimeout     time.Duration          `mapstructure:"run-after-timeout"`
+	RunAfterFailTimeout time.Duration          `mapstructure:"run-after-fail-timeout"`
+	RunFinallyTimeout   time.Duration          `mapstructure:"run-finally-timeout"`
+	OtherFlags          map[string]interface{} `mapstructure:",remain"`
+}
+
+// RunCommands contains the shell commands to run before and after a restic command, with their timeouts
+type RunCommands struct {
+	RunBefore           []string
+	RunAfter            []string
+	RunAfterFail        []string
+	RunFinally          []string
+	RunBeforeTimeout    time.Duration
+	RunAfterTimeout     time.Duration
+	RunAfterFailTimeout time.Duration
+	RunFinallyTimeout   time.Duration
+}
+
+// RetrySection contains the configuration to run a restic command again after a failure
+type RetrySection struct {
+	MaxAttempts   int           `mapstructure:"max-attempts"`
+	Delay         time.Duration `mapstructure:"delay"`
+	BackoffFactor float64       `mapstructure:"backoff-factor"`
+	MaxDelay      time.Duration `mapstructure:"max-delay"`
+	ErrorPattern  string        `mapstructure:"error-pattern"`
+	ExitCodes     []int         `mapstructure:"exit-codes"`
 }
 
 // NewProfile instantiates a new blank profile
@@ -78,6 +158,14 @@ func NewProfile(c *Config, name string) *Profile {
 	}
 }
 
+// GetConfigFile returns the path of the configuration file of the profile (empty if the profile is not loaded from a file)
+func (p *Profile) GetConfigFile() string {
+	if p.config == nil {
+		return ""
+	}
+	return p.config.GetConfigFile()
+}
+
 // SetRootPath changes the path of all the relative paths and files in the configuration
 func (p *Profile) SetRootPath(rootPath string) {
 
@@ -87,6 +175,17 @@ func (p *Profile) SetRootPath(rootPath string) {
 	p.CACert = fixPath(p.CACert, expandEnv, absolutePrefix(rootPath), unixSpaces)
 	p.TLSClientCert = fixPath(p.TLSClientCert, expandEnv, absolutePrefix(rootPath), unixSpaces)
 
+	// secrets stored in files are also relative to the configuration
+	p.Password = fixSecretFile(p.Password, expandEnv, absolutePrefix(rootPath))
+	for key, value := range p.Environment {
+		p.Environment[key] = fixSecretFile(value, expandEnv, absolutePrefix(rootPath))
+	}
+
+	if p.EnvFiles != nil && len(p.EnvFiles) > 0 {
+		// env files are read by resticprofile, not by the shell: no need to escape the spaces
+		p.EnvFiles = fixPaths(p.EnvFiles, expandEnv, absolutePrefix(rootPath))
+	}
+
 	if p.Backup != nil {
 		if p.Backup.ExcludeFile != nil && len(p.Backup.ExcludeFile) > 0 {
 			p.Backup.ExcludeFile = fixPaths(p.Backup.ExcludeFile, expandEnv, absolutePrefix(rootPath), unixSpaces)
@@ -111,14 +210,10 @@ func (p *Profile) SetHost(hostname string) {
 	if p.Retention != nil && p.Retention.OtherFlags != nil {
 		replaceTrueValue(p.Retention.OtherFlags, constants.ParameterHost, hostname)
 	}
-	if p.Snapshots != nil {
-		replaceTrueValue(p.Snapshots, constants.ParameterHost, hostname)
-	}
-	if p.Forget != nil {
-		replaceTrueValue(p.Forget, constants.ParameterHost, hostname)
-	}
-	if p.Mount != nil {
-		replaceTrueValue(p.Mount, constants.ParameterHost, hostname)
+	for _, section := range []*OtherSection{p.Snapshots, p.Forget, p.Mount, p.Prune, p.Copy} {
+		if section != nil && section.OtherFlags != nil {
+			replaceTrueValue(section.OtherFlags, constants.ParameterHost, hostname)
+		}
 	}
 }
 
@@ -129,6 +224,11 @@ func (p *Profile) GetCommonFlags() map[string][]string {
 
 	flags = addOtherFlags(flags, p.OtherFlags)
 
+	// restic is running the password command itself
+	if secret.IsCommand(p.Password) {
+		flags[constants.ParameterPasswordCommand] = []string{secret.Command(p.Password)}
+	}
+
 	return flags
 }
 
@@ -150,7 +250,7 @@ func (p *Profile) GetCommandFlags(command string) map[string][]string {
 
 	case constants.CommandSnapshots:
 		if p.Snapshots != nil {
-			flags = addOtherFlags(flags, p.Snapshots)
+			flags = addOtherFlags(flags, p.Snapshots.OtherFlags)
 		}
 
 	case constants.CommandCheck:
@@ -160,12 +260,22 @@ func (p *Profile) GetCommandFlags(command string) map[string][]string {
 
 	case constants.CommandForget:
 		if p.Forget != nil {
-			flags = addOtherFlags(flags, p.Forget)
+			flags = addOtherFlags(flags, p.Forget.OtherFlags)
 		}
 
 	case constants.CommandMount:
 		if p.Mount != nil {
-			flags = addOtherFlags(flags, p.Mount)
+			flags = addOtherFlags(flags, p.Mount.OtherFlags)
+		}
+
+	case constants.CommandPrune:
+		if p.Prune != nil {
+			flags = addOtherFlags(flags, p.Prune.OtherFlags)
+		}
+
+	case constants.CommandCopy:
+		if p.Copy != nil {
+			flags = addOtherFlags(flags, p.Copy.OtherFlags)
 		}
 	}
 
@@ -241,6 +351,160 @@ func (p *Profile) Schedules() []*ScheduleConfig {
 	}
 	return configs
 }
+
+// MaxAges returns the maximum age of the last successful run of each command with a max-age in its section.
+// The commands without a max-age are not returned
+func (p *Profile) MaxAges() map[string]time.Duration {
+	maxAges := make(map[string]time.Duration)
+	if p.Backup != nil && p.Backup.MaxAge > 0 {
+		maxAges[constants.CommandBackup] = p.Backup.MaxAge
+	}
+	if p.Retention != nil && p.Retention.MaxAge > 0 {
+		maxAges[constants.SectionConfigurationRetention] = p.Retention.MaxAge
+	}
+	if p.Check != nil && p.Check.MaxAge > 0 {
+		maxAges[constants.CommandCheck] = p.Check.MaxAge
+	}
+	for _, command := range otherSectionCommands {
+		if section := p.otherSection(command); section != nil && section.MaxAge > 0 {
+			maxAges[command] = section.MaxAge
+		}
+	}
+	return maxAges
+}
+
+// GetRetry returns the retry configuration of the command: the retry section of the command,
+// or the retry section of the profile otherwise. It returns nil when the command shouldn't be retried
+func (p *Profile) GetRetry(command string) *RetrySection {
+	var retry *RetrySection
+	switch command {
+	case constants.CommandBackup:
+		if p.Backup != nil {
+			retry = p.Backup.Retry
+		}
+	case constants.SectionConfigurationRetention:
+		if p.Retention != nil {
+			retry = p.Retention.Retry
+		}
+	case constants.CommandCheck:
+		if p.Check != nil {
+			retry = p.Check.Retry
+		}
+	default:
+		if section := p.otherSection(command); section != nil {
+			retry = section.Retry
+		}
+	}
+	if retry == nil {
+		retry = p.Retry
+	}
+	if retry == nil || retry.MaxAttempts < 2 {
+		return nil
+	}
+	return retry
+}
+
+// GetTimeout returns the maximum duration of the restic command: the timeout of the section of the command,
+// or the timeout of the profile otherwise. Zero means no timeout
+func (p *Profile) GetTimeout(command string) time.Duration {
+	var timeout time.Duration
+	switch command {
+	case constants.CommandBackup:
+		if p.Backup != nil {
+			timeout = p.Backup.Timeout
+		}
+	case constants.SectionConfigurationRetention:
+		if p.Retention != nil {
+			timeout = p.Retention.Timeout
+		}
+	case constants.CommandCheck:
+		if p.Check != nil {
+			timeout = p.Check.Timeout
+		}
+	default:
+		if section := p.otherSection(command); section != nil {
+			timeout = section.Timeout
+		}
+	}
+	if timeout > 0 {
+		return timeout
+	}
+	return p.Timeout
+}
+
+// GetRunCommands returns the shell commands to run before and after the restic command, from the section of the command.
+// The returned value is empty when the command has no section
+func (p *Profile) GetRunCommands(command string) RunCommands {
+	switch command {
+	case constants.CommandBackup:
+		if p.Backup != nil {
+			return RunCommands{
+				RunBefore:           p.Backup.RunBefore,
+				RunAfter:            p.Backup.RunAfter,
+				RunAfterFail:        p.Backup.RunAfterFail,
+				RunFinally:          p.Backup.RunFinally,
+				RunBeforeTimeout:    p.Backup.RunBeforeTimeout,
+				RunAfterTimeout:     p.Backup.RunAfterTimeout,
+				RunAfterFailTimeout: p.Backup.RunAfterFailTimeout,
+				RunFinallyTimeout:   p.Backup.RunFinallyTimeout,
+			}
+		}
+	case constants.CommandCheck:
+		if p.Check != nil {
+			return RunCommands{
+				RunBefore:           p.Check.RunBefore,
+				RunAfter:            p.Check.RunAfter,
+				RunAfterFail:        p.Check.RunAfterFail,
+				RunFinally:          p.Check.RunFinally,
+				RunBeforeTimeout:    p.Check.RunBeforeTimeout,
+				RunAfterTimeout:     p.Check.RunAfterTimeout,
+				RunAfterFailTimeout: p.Check.RunAfterFailTimeout,
+				RunFinallyTimeout:   p.Check.RunFinallyTimeout,
+			}
+		}
+	default:
+		if section := p.otherSection(command); section != nil {
+			return RunCommands{
+				RunBefore:           section.RunBefore,
+				RunAfter:            section.RunAfter,
+				RunAfterFail:        section.RunAfterFail,
+				RunFinally:          section.RunFinally,
+				RunBeforeTimeout:    section.RunBeforeTimeout,
+				RunAfterTimeout:     section.RunAfterTimeout,
+				RunAfterFailTimeout: section.RunAfterFailTimeout,
+				RunFinallyTimeout:   section.RunFinallyTimeout,
+			}
+		}
+	}
+	return RunCommands{}
+}
+
+// otherSectionCommands are the commands with no specific configuration (see otherSection)
+var otherSectionCommands = []string{
+	constants.CommandSnapshots,
+	constants.CommandForget,
+	constants.CommandMount,
+	constants.CommandPrune,
+	constants.CommandCopy,
+}
+
+// otherSection returns the section of a command with no specific configuration, or nil if not defined
+func (p *Profile) otherSection(command string) *OtherSection {
+	switch command {
+	case constants.CommandSnapshots:
+		return p.Snapshots
+	case constants.CommandForget:
+		return p.Forget
+	case constants.CommandMount:
+		return p.Mount
+	case constants.CommandPrune:
+		return p.Prune
+	case constants.CommandCopy:
+		return p.Copy
+	}
+	return nil
+}
+
 func addOtherFlags(flags map[string][]string, otherFlags map[string]interface{}) map[string][]string {
 	if len(otherFlags) == 0 {
 		return flags
@@ -268,6 +532,14 @@ func mergeFlags(flags, newFlags map[string][]string) map[string][]string {
 	return flags
 }
 
+// fixSecretFile applies the path fixing callbacks to a "file:" secret reference
+func fixSecretFile(value string, callbacks ...pathFix) string {
+	if !strings.HasPrefix(value, secret.PrefixFile) {
+		return value
+	}
+	return secret.PrefixFile + fixPath(strings.TrimPrefix(value, secret.PrefixFile), callbacks...)
+}
+
 func replaceTrueValue(source map[string]interface{}, key, replace string) {
 	if genericValue, ok := source[key]; ok {
 		if value, ok := genericValue.(bool); ok {
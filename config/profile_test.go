@@ -4,6 +4,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/creativeprojects/resticprofile/constants"
 	"github.com/stretchr/testify/assert"
@@ -332,7 +333,203 @@ profile:
 
 			assert.NotNil(t, profile)
 			assert.NotNil(t, profile.Forget)
-			assert.NotEmpty(t, profile.Forget["keep-daily"])
+			assert.NotEmpty(t, profile.Forget.OtherFlags["keep-daily"])
 		})
 	}
 }
+
+func TestPasswordCommandFlag(t *testing.T) {
+	testConfig := `
+[profile]
+password = "cmd: pass show restic/backup"
+`
+	profile, err := getProfile("toml", testConfig, "profile")
+	require.NoError(t, err)
+	require.NotNil(t, profile)
+
+	flags := profile.GetCommonFlags()
+	assert.Equal(t, []string{"pass show restic/backup"}, flags["password-command"])
+	assert.NotContains(t, flags, "password")
+}
+
+func TestPasswordIsNotAFlag(t *testing.T) {
+	testConfig := `
+[profile]
+password = "env:BACKUP_PASSWORD"
+`
+	profile, err := getProfile("toml", testConfig, "profile")
+	require.NoError(t, err)
+	require.NotNil(t, profile)
+
+	flags := profile.GetCommonFlags()
+	assert.NotContains(t, flags, "password-command")
+	assert.NotContains(t, flags, "password")
+}
+
+func TestMaxAges(t *testing.T) {
+	testConfig := `
+[profile]
+history-retention = "2160h"
+[profile.backup]
+max-age = "26h"
+[profile.retention]
+after-backup = true
+[profile.check]
+max-age = "720h"
+[profile.prune]
+max-age = "168h"
+[profile.copy]
+max-age = "48h"
+[profile.forget]
+keep-last = 10
+`
+	profile, err := getProfile("toml", testConfig, "profile")
+	require.NoError(t, err)
+	require.NotNil(t, profile)
+
+	assert.Equal(t, map[string]time.Duration{
+		constants.CommandBackup: 26 * time.Hour,
+		constants.CommandCheck:  720 * time.Hour,
+		constants.CommandPrune:  168 * time.Hour,
+		constants.CommandCopy:   48 * time.Hour,
+	}, profile.MaxAges())
+	assert.Equal(t, 2160*time.Hour, profile.HistoryMaxAge)
+	assert.NotContains(t, profile.GetCommandFlags(constants.CommandBackup), "max-age")
+	assert.NotContains(t, profile.GetCommandFlags(constants.CommandCheck), "max-age")
+	assert.NotContains(t, profile.GetCommandFlags(constants.CommandPrune), "max-age")
+}
+
+func TestGetRetry(t *testing.T) {
+	testConfig := `
+[profile]
+[profile.retry]
+max-attempts = 3
+delay = "30s"
+backoff-factor = 1.5
+exit-codes = [1, 3]
+[profile.backup]
+[profile.backup.retry]
+max-attempts = 5
+error-pattern = "i/o timeout"
+[profile.check]
+[profile.check.retry]
+max-attempts = 1
+[profile.copy]
+[profile.copy.retry]
+max-attempts = 4
+delay = "5m"
+`
+	profile, err := getProfile("toml", testConfig, "profile")
+	require.NoError(t, err)
+	require.NotNil(t, profile)
+
+	retry := profile.GetRetry(constants.CommandBackup)
+	require.NotNil(t, retry)
+	assert.Equal(t, 5, retry.MaxAttempts)
+	assert.Equal(t, "i/o timeout", retry.ErrorPattern)
+
+	retry = profile.GetRetry(constants.CommandPrune)
+	require.NotNil(t, retry)
+	assert.Equal(t, 3, retry.MaxAttempts)
+	assert.Equal(t, 30*time.Second, retry.Delay)
+	assert.Equal(t, 1.5, retry.BackoffFactor)
+	assert.Equal(t, []int{1, 3}, retry.ExitCodes)
+
+	retry = profile.GetRetry(constants.CommandCopy)
+	require.NotNil(t, retry)
+	assert.Equal(t, 4, retry.MaxAttempts)
+	assert.Equal(t, 5*time.Minute, retry.Delay)
+
+	// a single attempt disables the retry
+	assert.Nil(t, profile.GetRetry(constants.CommandCheck))
+
+	assert.NotContains(t, profile.GetCommonFlags(), "retry")
+	assert.NotContains(t, profile.GetCommandFlags(constants.CommandBackup), "retry")
+	assert.NotContains(t, profile.GetCommandFlags(constants.CommandCopy), "retry")
+}
+
+func TestGetTimeout(t *testing.T) {
+	testConfig := `
+[profile]
+timeout = "1h"
+run-before-timeout = "5m"
+run-after-fail-timeout = "30s"
+[profile.backup]
+timeout = "6h"
+run-after-timeout = "10m"
+[profile.retention]
+timeout = "20m"
+[profile.prune]
+timeout = "3h"
+`
+	profile, err := getProfile("toml", testConfig, "profile")
+	require.NoError(t, err)
+	require.NotNil(t, profile)
+
+	assert.Equal(t, 6*time.Hour, profile.GetTimeout(constants.CommandBackup))
+	assert.Equal(t, time.Hour, profile.GetTimeout(constants.CommandCheck))
+	assert.Equal(t, 20*time.Minute, profile.GetTimeout(constants.SectionConfigurationRetention))
+	assert.Equal(t, 3*time.Hour, profile.GetTimeout(constants.CommandPrune))
+	assert.Equal(t, time.Hour, profile.GetTimeout(constants.CommandForget))
+	assert.NotContains(t, profile.GetCommandFlags(constants.CommandPrune), "timeout")
+	assert.NotContains(t, profile.GetRetentionFlags(), "timeout")
+	assert.Equal(t, 5*time.Minute, profile.RunBeforeTimeout)
+	assert.Equal(t, 30*time.Second, profile.RunAfterFailTimeout)
+	assert.Equal(t, 10*time.Minute, profile.Backup.RunAfterTimeout)
+
+	assert.NotContains(t, profile.GetCommonFlags(), "timeout")
+	assert.NotContains(t, profile.GetCommandFlags(constants.CommandBackup), "timeout")
+}
+
+func TestGetRunCommands(t *testing.T) {
+	testConfig := `
+[profile]
+run-finally = "echo profile"
+[profile.backup]
+run-before = "echo before backup"
+run-finally = ["echo backup", "echo done"]
+run-finally-timeout = "1m"
+[profile.check]
+run-after-fail = "echo check failed"
+[profile.prune]
+run-after = "echo after prune"
+max-unused = "5%"
+`
+	profile, err := getProfile("toml", testConfig, "profile")
+	require.NoError(t, err)
+	require.NotNil(t, profile)
+
+	assert.Equal(t, []string{"echo profile"}, profile.RunFinally)
+
+	backup := profile.GetRunCommands(constants.CommandBackup)
+	assert.Equal(t, []string{"echo before backup"}, backup.RunBefore)
+	assert.Equal(t, []string{"echo backup", "echo done"}, backup.RunFinally)
+	assert.Equal(t, time.Minute, backup.RunFinallyTimeout)
+
+	assert.Equal(t, []string{"echo check failed"}, profile.GetRunCommands(constants.CommandCheck).RunAfterFail)
+	assert.Equal(t, []string{"echo after prune"}, profile.GetRunCommands(constants.CommandPrune).RunAfter)
+	assert.Empty(t, profile.GetRunCommands(constants.CommandSnapshots).RunBefore)
+
+	flags := profile.GetCommandFlags(constants.CommandPrune)
+	assert.Equal(t, []string{"5%"}, flags["max-unused"])
+	assert.NotContains(t, flags, "run-after")
+	assert.NotContains(t, profile.GetCommandFlags(constants.CommandBackup), "run-finally")
+}
+
+func TestSecretFileIsRelativeToConfiguration(t *testing.T) {
+	testConfig := `
+[profile]
+password = "file:key"
+[profile.env]
+aws_secret_access_key = "file:aws-key"
+other = "file"
+`
+	profile, err := getProfile("toml", testConfig, "profile")
+	require.NoError(t, err)
+	require.NotNil(t, profile)
+
+	profile.SetRootPath("root")
+	assert.Equal(t, "file:"+filepath.Join("root", "key"), profile.Password)
+	assert.Equal(t, "file:"+filepath.Join("root", "aws-key"), profile.Environment["aws_secret_access_key"])
+	assert.Equal(t, "file", profile.Environment["other"])
+}
@@ -1,5 +1,7 @@
 package config
 
+import "reflect"
+
 type ScheduleConfig struct {
 	profileName      string
 	commandName      string
@@ -76,3 +78,15 @@ func (s *ScheduleConfig) Nice() int {
 func (s *ScheduleConfig) Logfile() string {
 	return s.logfile
 }
+
+// Equal returns true when both configurations would create the same scheduled job.
+// The command line and the descriptions are not compared as they're not coming from the configuration
+func (s *ScheduleConfig) Equal(other *ScheduleConfig) bool {
+	return s.profileName == other.profileName &&
+		s.commandName == other.commandName &&
+		reflect.DeepEqual(s.schedules, other.schedules) &&
+		s.permission == other.permission &&
+		reflect.DeepEqual(s.environment, other.environment) &&
+		s.nice == other.nice &&
+		s.logfile == other.logfile
+}
@@ -35,3 +35,31 @@ func TestScheduleProperties(t *testing.T) {
 	assert.Equal(t, 11, schedule.Nice())
 	assert.Equal(t, "log.txt", schedule.Logfile())
 }
+
+func TestScheduleEqual(t *testing.T) {
+	schedule := &ScheduleConfig{
+		profileName: "profile",
+		commandName: "backup",
+		schedules:   []string{"daily"},
+		permission:  "user",
+		environment: map[string]string{"test": "dev"},
+		nice:        10,
+		logfile:     "log.txt",
+	}
+	same := *schedule
+	same.SetCommand("home", "resticprofile", []string{"backup"})
+	same.SetJobDescription("job")
+	assert.True(t, schedule.Equal(&same))
+
+	different := *schedule
+	different.schedules = []string{"daily", "weekly"}
+	assert.False(t, schedule.Equal(&different))
+
+	different = *schedule
+	different.environment = map[string]string{"test": "prod"}
+	assert.False(t, schedule.Equal(&different))
+
+	different = *schedule
+	different.permission = "system"
+	assert.False(t, schedule.Equal(&different))
+}
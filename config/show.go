@@ -6,6 +6,8 @@ import (
 	"io"
 	"reflect"
 	"text/tabwriter"
+
+	"github.com/creativeprojects/resticprofile/secret"
 )
 
 const (
@@ -115,6 +117,12 @@ func showKeyValue(tabWriter io.Writer, prefix, key string, valueOf reflect.Value
 	}
 	// This is reusing the stringifyValue function used to build the restic flags
 	convert, ok := stringifyValue(valueOf)
+	if ok && secret.IsSensitiveKey(key) {
+		// never display a secret
+		for i := range convert {
+			convert[i] = secret.Mask(convert[i])
+		}
+	}
 	if ok {
 		if len(convert) == 0 {
 			// special case of a true flag that shows no value
@@ -67,3 +67,24 @@ func TestShowStruct(t *testing.T) {
 		assert.Equal(t, testItem.output, strings.ReplaceAll(b.String(), "    ", " "))
 	}
 }
+
+func TestShowStructMasksSecrets(t *testing.T) {
+	profile := &Profile{
+		Password:     "my password",
+		PasswordFile: "key",
+		Environment: map[string]string{
+			"aws_access_key_id":     "id",
+			"aws_secret_access_key": "secret",
+			"restic_password":       "env:BACKUP_PASSWORD",
+		},
+	}
+	b := &strings.Builder{}
+	err := ShowStruct(b, profile)
+	assert.NoError(t, err)
+	output := b.String()
+	assert.NotContains(t, output, "my password")
+	assert.NotContains(t, output, "secret\n")
+	assert.Contains(t, output, "env:BACKUP_PASSWORD")
+	assert.Contains(t, output, "key")
+	assert.Contains(t, output, "id")
+}
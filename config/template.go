@@ -2,7 +2,9 @@ package config
 
 import (
 	"os"
+	"os/user"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"time"
 )
@@ -14,17 +16,31 @@ type TemplateData struct {
 	CurrentDir string
 	ConfigDir  string
 	Env        map[string]string
+	Vars       map[string]string
+	Hostname   string
+	OS         string
+	Arch       string
+	User       UserTemplateData
+	Binary     string
 }
 
 // ProfileTemplateData contains profile data
 type ProfileTemplateData struct {
-	Name string
+	Name    string
+	Command string
+}
+
+// UserTemplateData contains information about the user running resticprofile
+type UserTemplateData struct {
+	Name    string
+	UID     string
+	GID     string
+	HomeDir string
 }
 
 // newTemplateData populates a TemplateData struct ready to use
-func newTemplateData(configFile, profileName string) TemplateData {
+func newTemplateData(configDir, profileName, command string) TemplateData {
 	currentDir, _ := os.Getwd()
-	configDir := filepath.Dir(configFile)
 	if !filepath.IsAbs(configDir) {
 		configDir = filepath.Join(currentDir, configDir)
 	}
@@ -36,13 +52,37 @@ func newTemplateData(configFile, profileName string) TemplateData {
 		}
 		env[keyValuePair[0]] = keyValuePair[1]
 	}
+	// the HOSTNAME environment variable is not always available (like when running from systemd)
+	hostname, _ := os.Hostname()
+	binary, _ := os.Executable()
+
 	return TemplateData{
 		Profile: ProfileTemplateData{
-			Name: profileName,
+			Name:    profileName,
+			Command: command,
 		},
 		Now:        time.Now(),
 		ConfigDir:  configDir,
 		CurrentDir: currentDir,
 		Env:        env,
+		Vars:       map[string]string{},
+		Hostname:   hostname,
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		User:       newUserTemplateData(),
+		Binary:     binary,
+	}
+}
+
+func newUserTemplateData() UserTemplateData {
+	current, err := user.Current()
+	if err != nil {
+		return UserTemplateData{}
+	}
+	return UserTemplateData{
+		Name:    current.Username,
+		UID:     current.Uid,
+		GID:     current.Gid,
+		HomeDir: current.HomeDir,
 	}
 }
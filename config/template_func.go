@@ -0,0 +1,176 @@
+package config
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// templateFuncs returns the functions available in the configuration templates.
+//
+// The value to transform is always the last parameter so the functions can be used in a pipeline:
+//
+//	{{ .Profile.Name | upper }}
+func templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		// strings
+		"lower":     strings.ToLower,
+		"upper":     strings.ToUpper,
+		"trim":      strings.TrimSpace,
+		"replace":   templateReplace,
+		"split":     templateSplit,
+		"join":      templateJoin,
+		"contains":  templateContains,
+		"hasPrefix": templateHasPrefix,
+		"hasSuffix": templateHasSuffix,
+		"default":   templateDefault,
+		// environment
+		"hostname": templateHostname,
+		"os":       func() string { return runtime.GOOS },
+		"arch":     func() string { return runtime.GOARCH },
+		"env":      templateEnv,
+		"tempDir":  os.TempDir,
+		// paths
+		"base":       filepath.Base,
+		"dir":        filepath.Dir,
+		"ext":        filepath.Ext,
+		"abs":        templateAbs,
+		"joinPath":   filepath.Join,
+		"fileExists": templateFileExists,
+		"dirExists":  templateDirExists,
+		// dates
+		"addDays":     templateAddDays,
+		"addDuration": templateAddDuration,
+		"date":        templateDate,
+		// others
+		"hash": templateHash,
+		"uuid": templateUUID,
+	}
+}
+
+// templateReplace replaces all occurrences of old by new in value
+func templateReplace(old, new, value string) string {
+	return strings.ReplaceAll(value, old, new)
+}
+
+// templateSplit splits value into a list of strings
+func templateSplit(separator, value string) []string {
+	return strings.Split(value, separator)
+}
+
+// templateJoin concatenates the items of the list (of any type) with the separator
+func templateJoin(separator string, list interface{}) (string, error) {
+	switch values := list.(type) {
+	case []string:
+		return strings.Join(values, separator), nil
+	case []interface{}:
+		items := make([]string, len(values))
+		for i, value := range values {
+			items[i] = fmt.Sprint(value)
+		}
+		return strings.Join(items, separator), nil
+	case string:
+		return values, nil
+	}
+	return "", fmt.Errorf("join: unsupported type %T", list)
+}
+
+func templateContains(substring, value string) bool {
+	return strings.Contains(value, substring)
+}
+
+func templateHasPrefix(prefix, value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+func templateHasSuffix(suffix, value string) bool {
+	return strings.HasSuffix(value, suffix)
+}
+
+// templateDefault returns the default value when the value is empty (or not defined)
+func templateDefault(defaultValue interface{}, value ...interface{}) interface{} {
+	if len(value) == 0 || value[0] == nil {
+		return defaultValue
+	}
+	if stringValue, ok := value[0].(string); ok && stringValue == "" {
+		return defaultValue
+	}
+	return value[0]
+}
+
+func templateHostname() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return hostname
+}
+
+// templateEnv returns the value of the environment variable, or the fallback value if it's not defined or empty
+func templateEnv(key string, fallback ...string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	if len(fallback) > 0 {
+		return fallback[0]
+	}
+	return ""
+}
+
+func templateAbs(path string) (string, error) {
+	return filepath.Abs(path)
+}
+
+func templateFileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+func templateDirExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// templateAddDays adds a number of days (which can be negative) to the date
+func templateAddDays(days int, date time.Time) time.Time {
+	return date.AddDate(0, 0, days)
+}
+
+// templateAddDuration adds a duration like "-1h30m" to the date
+func templateAddDuration(duration string, date time.Time) (time.Time, error) {
+	value, err := time.ParseDuration(duration)
+	if err != nil {
+		return date, err
+	}
+	return date.Add(value), nil
+}
+
+// templateDate formats the date using the go layout (like "2006-01-02")
+func templateDate(layout string, date time.Time) string {
+	return date.Format(layout)
+}
+
+// templateHash returns the SHA256 hexadecimal representation of the value
+func templateHash(value string) string {
+	hash := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(hash[:])
+}
+
+// templateUUID generates a random (version 4) UUID
+func templateUUID() (string, error) {
+	uuid := make([]byte, 16)
+	_, err := rand.Read(uuid)
+	if err != nil {
+		return "", err
+	}
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:]), nil
+}
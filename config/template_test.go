@@ -1,6 +1,11 @@
 package config
 
 import (
+	"bytes"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 	"testing"
@@ -185,7 +190,7 @@ tag = ["test", "{{ .Profile.Name }}"]
 	require.NoError(t, err)
 	require.NotEmpty(t, profile)
 
-	assert.Contains(t, profile.Snapshots["tag"], "profile1")
+	assert.Contains(t, profile.Snapshots.OtherFlags["tag"], "profile1")
 }
 
 func TestInheritanceWithTemplates(t *testing.T) {
@@ -289,7 +294,128 @@ profile:
 			assert.NotNil(t, profile.Backup)
 			assert.Contains(t, profile.Backup.OtherFlags["tag"], "profile")
 			assert.NotNil(t, profile.Forget)
-			assert.Contains(t, profile.Forget["tag"], "profile")
+			assert.Contains(t, profile.Forget.OtherFlags["tag"], "profile")
 		})
 	}
 }
+
+func TestTemplateFunctions(t *testing.T) {
+	clog.SetTestLog(t)
+	defer clog.CloseTestLog()
+
+	hostname, _ := os.Hostname()
+	os.Setenv("TEST_TEMPLATE_FUNCTIONS", "from env")
+	defer os.Unsetenv("TEST_TEMPLATE_FUNCTIONS")
+
+	testData := []struct {
+		template string
+		expected string
+	}{
+		{`{{ .Profile.Name | upper }}`, "PROFILE1"},
+		{`{{ "ABC" | lower }}`, "abc"},
+		{`{{ "  abc  " | trim }}`, "abc"},
+		{`{{ .Profile.Name | replace "profile" "backup-" }}`, "backup-1"},
+		{`{{ "a,b,c" | split "," | join "-" }}`, "a-b-c"},
+		{`{{ if .Profile.Name | contains "file" }}yes{{ end }}`, "yes"},
+		{`{{ if .Profile.Name | hasPrefix "pro" }}yes{{ end }}`, "yes"},
+		{`{{ if .Profile.Name | hasSuffix "1" }}yes{{ end }}`, "yes"},
+		{`{{ .Env.TEST_TEMPLATE_FUNCTIONS_NOT_DEFINED | default "none" }}`, "none"},
+		{`{{ "value" | default "none" }}`, "value"},
+		{`{{ hostname }}`, hostname},
+		{`{{ os }}/{{ arch }}`, runtime.GOOS + "/" + runtime.GOARCH},
+		{`{{ env "TEST_TEMPLATE_FUNCTIONS" }}`, "from env"},
+		{`{{ env "TEST_TEMPLATE_FUNCTIONS_NOT_DEFINED" "fallback" }}`, "fallback"},
+		{`{{ tempDir }}`, os.TempDir()},
+		{`{{ "/some/path/file.txt" | base }}`, "file.txt"},
+		{`{{ "/some/path/file.txt" | ext }}`, ".txt"},
+		{`{{ joinPath "some" "path" }}`, filepath.Join("some", "path")},
+		{`{{ if fileExists "template_test.go" }}yes{{ end }}`, "yes"},
+		{`{{ if fileExists "template_test.go.not" }}yes{{ else }}no{{ end }}`, "no"},
+		{`{{ if dirExists "../config" }}yes{{ end }}`, "yes"},
+		{`{{ .Now | addDays 1 | date "2006-01-02" }}`, time.Now().AddDate(0, 0, 1).Format("2006-01-02")},
+		{`{{ .Now | addDuration "-24h" | date "2006-01-02" }}`, time.Now().Add(-24 * time.Hour).Format("2006-01-02")},
+		{`{{ hash "test" }}`, "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"},
+		{`{{ uuid | len }}`, "36"},
+	}
+
+	for _, testItem := range testData {
+		t.Run(testItem.template, func(t *testing.T) {
+			testConfig := "[profile1]\nrepository = '" + testItem.template + "'\n"
+			profile, err := getResolvedProfile("toml", testConfig, "profile1")
+			require.NoError(t, err)
+			require.NotEmpty(t, profile)
+
+			assert.Equal(t, testItem.expected, profile.Repository)
+		})
+	}
+}
+
+func TestTemplateFunctionError(t *testing.T) {
+	testConfig := `
+[profile1]
+repository = "{{ .Now | addDuration "not a duration" }}"
+`
+	_, err := getResolvedProfile("toml", testConfig, "profile1")
+	assert.Error(t, err)
+}
+
+func TestTemplateDataContext(t *testing.T) {
+	clog.SetTestLog(t)
+	defer clog.CloseTestLog()
+
+	hostname, _ := os.Hostname()
+	binary, _ := os.Executable()
+	currentUser, err := user.Current()
+	require.NoError(t, err)
+
+	testData := []struct {
+		template string
+		expected string
+	}{
+		{`{{ .Hostname }}`, hostname},
+		{`{{ .OS }}`, runtime.GOOS},
+		{`{{ .Arch }}`, runtime.GOARCH},
+		{`{{ .User.Name }}`, currentUser.Username},
+		{`{{ .User.HomeDir }}`, currentUser.HomeDir},
+		{`{{ .Binary }}`, binary},
+		{`{{ .Profile.Command }}`, "check"},
+	}
+
+	for _, testItem := range testData {
+		t.Run(testItem.template, func(t *testing.T) {
+			testConfig := "[profile1]\nrepository = '" + testItem.template + "'\n"
+			c, err := Load(bytes.NewBufferString(testConfig), "toml")
+			require.NoError(t, err)
+
+			profile, err := c.GetProfile("profile1", "check")
+			require.NoError(t, err)
+			require.NotEmpty(t, profile)
+
+			assert.Equal(t, testItem.expected, profile.Repository)
+		})
+	}
+}
+
+func TestTemplateVaryingPerCommand(t *testing.T) {
+	clog.SetTestLog(t)
+	defer clog.CloseTestLog()
+
+	testConfig := `
+[profile1]
+{{ if eq .Profile.Command "backup" }}
+lock = "/tmp/backup.lock"
+{{ else }}
+lock = "/tmp/other.lock"
+{{ end }}
+`
+	c, err := Load(bytes.NewBufferString(testConfig), "toml")
+	require.NoError(t, err)
+
+	profile, err := c.GetProfile("profile1", "backup")
+	require.NoError(t, err)
+	assert.Equal(t, "/tmp/backup.lock", profile.Lock)
+
+	profile, err = c.GetProfile("profile1", "snapshots")
+	require.NoError(t, err)
+	assert.Equal(t, "/tmp/other.lock", profile.Lock)
+}
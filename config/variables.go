@@ -0,0 +1,181 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/creativeprojects/resticprofile/constants"
+	"github.com/mitchellh/mapstructure"
+)
+
+var (
+	variableReference = regexp.MustCompile(`\$\{([A-Za-z0-9_.-]+)\}`)
+)
+
+// variablesSection is used to load the variables (and the parent profile) from a profile
+type variablesSection struct {
+	Inherit   string                 `mapstructure:"inherit"`
+	Variables map[string]interface{} `mapstructure:"variables"`
+}
+
+// getVariables returns the resolved variables from the "variables" section, merged with the variables of the profile
+// (and its parents). Leave profileKey empty to only load the variables from the "variables" section.
+func (c *Config) getVariables(profileKey string) (map[string]string, error) {
+	raw := make(map[string]string)
+	if c.IsSet(constants.SectionConfigurationVariables) {
+		variables := make(map[string]interface{})
+		// don't expand the variables while we're loading them
+		err := c.viper.UnmarshalKey(constants.SectionConfigurationVariables, &variables, c.decodeHook(nil))
+		if err != nil {
+			return nil, fmt.Errorf("cannot load variables: %w", err)
+		}
+		mergeVariables(raw, variables)
+	}
+	if profileKey != "" {
+		err := c.loadProfileVariables(raw, profileKey, map[string]bool{})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resolveVariables(raw)
+}
+
+// loadProfileVariables merges the variables of the profile into raw, after the variables of its parent
+func (c *Config) loadProfileVariables(raw map[string]string, profileKey string, visited map[string]bool) error {
+	if visited[profileKey] || !c.IsSet(profileKey) {
+		return nil
+	}
+	visited[profileKey] = true
+	section := &variablesSection{}
+	// don't expand the variables while we're loading them
+	err := c.viper.UnmarshalKey(profileKey, section, c.decodeHook(nil))
+	if err != nil {
+		return fmt.Errorf("cannot load variables of profile '%s': %w", profileKey, err)
+	}
+	if section.Inherit != "" {
+		err = c.loadProfileVariables(raw, section.Inherit, visited)
+		if err != nil {
+			return err
+		}
+	}
+	mergeVariables(raw, section.Variables)
+	return nil
+}
+
+func mergeVariables(raw map[string]string, variables map[string]interface{}) {
+	for name, value := range variables {
+		raw[strings.ToLower(name)] = fmt.Sprint(value)
+	}
+}
+
+// resolveVariables resolves the ${name} references to other variables or to environment variables
+func resolveVariables(raw map[string]string) (map[string]string, error) {
+	resolved := make(map[string]string, len(raw))
+	resolving := make(map[string]bool)
+
+	var resolve func(name string) (string, error)
+	resolve = func(name string) (string, error) {
+		if value, ok := resolved[name]; ok {
+			return value, nil
+		}
+		if resolving[name] {
+			return "", fmt.Errorf("circular reference in variable '%s'", name)
+		}
+		resolving[name] = true
+		var err error
+		value := variableReference.ReplaceAllStringFunc(raw[name], func(reference string) string {
+			if err != nil {
+				return reference
+			}
+			referenceName := variableReference.FindStringSubmatch(reference)[1]
+			if _, ok := raw[strings.ToLower(referenceName)]; ok {
+				var referenceValue string
+				referenceValue, err = resolve(strings.ToLower(referenceName))
+				return referenceValue
+			}
+			if envValue, ok := os.LookupEnv(referenceName); ok {
+				return envValue
+			}
+			err = fmt.Errorf("variable '%s': undefined reference to '%s'", name, reference)
+			return reference
+		})
+		if err != nil {
+			return "", err
+		}
+		resolved[name] = value
+		return value, nil
+	}
+
+	for name := range raw {
+		_, err := resolve(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resolved, nil
+}
+
+// expandVariables replaces the ${name} references to known variables.
+// Other references are left untouched (they can be environment variables expanded later)
+func expandVariables(value string, variables map[string]string) string {
+	if len(variables) == 0 || !strings.Contains(value, "${") {
+		return value
+	}
+	return variableReference.ReplaceAllStringFunc(value, func(reference string) string {
+		name := strings.ToLower(variableReference.FindStringSubmatch(reference)[1])
+		if variable, ok := variables[name]; ok {
+			return variable
+		}
+		return reference
+	})
+}
+
+// variablesHookFunc expands the variables in all the string values.
+//
+// The hook is also expanding the values inside maps and slices, because the values kept in a ",remain" map
+// are not decoded individually
+func variablesHookFunc(variables map[string]string) mapstructure.DecodeHookFunc {
+	return func(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+		return expandAllVariables(data, variables), nil
+	}
+}
+
+// expandAllVariables returns a copy of data where the variables in all strings are expanded
+func expandAllVariables(data interface{}, variables map[string]string) interface{} {
+	switch value := data.(type) {
+	case string:
+		return expandVariables(value, variables)
+
+	case []interface{}:
+		expanded := make([]interface{}, len(value))
+		for i, item := range value {
+			expanded[i] = expandAllVariables(item, variables)
+		}
+		return expanded
+
+	case []string:
+		expanded := make([]string, len(value))
+		for i, item := range value {
+			expanded[i] = expandVariables(item, variables)
+		}
+		return expanded
+
+	case map[string]interface{}:
+		expanded := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			expanded[key] = expandAllVariables(item, variables)
+		}
+		return expanded
+
+	case []map[string]interface{}:
+		expanded := make([]map[string]interface{}, len(value))
+		for i, item := range value {
+			expanded[i] = expandAllVariables(item, variables).(map[string]interface{})
+		}
+		return expanded
+	}
+	return data
+}
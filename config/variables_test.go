@@ -0,0 +1,139 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveVariables(t *testing.T) {
+	os.Setenv("TEST_RESOLVE_VARIABLES", "from_env")
+	defer os.Unsetenv("TEST_RESOLVE_VARIABLES")
+
+	resolved, err := resolveVariables(map[string]string{
+		"bucket": "backup-${host}",
+		"host":   "nas",
+		"path":   "${bucket}/${TEST_RESOLVE_VARIABLES}",
+		"plain":  "$HOME is not a reference",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"bucket": "backup-nas",
+		"host":   "nas",
+		"path":   "backup-nas/from_env",
+		"plain":  "$HOME is not a reference",
+	}, resolved)
+}
+
+func TestResolveVariablesErrors(t *testing.T) {
+	_, err := resolveVariables(map[string]string{
+		"bucket": "backup-${TEST_RESOLVE_VARIABLES_UNDEFINED}",
+	})
+	assert.EqualError(t, err, "variable 'bucket': undefined reference to '${TEST_RESOLVE_VARIABLES_UNDEFINED}'")
+
+	_, err = resolveVariables(map[string]string{
+		"first":  "${second}",
+		"second": "${first}",
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "circular reference")
+}
+
+func TestExpandVariables(t *testing.T) {
+	variables := map[string]string{"bucket": "backup"}
+	assert.Equal(t, "s3:host/backup", expandVariables("s3:host/${bucket}", variables))
+	assert.Equal(t, "s3:host/backup", expandVariables("s3:host/${BUCKET}", variables))
+	assert.Equal(t, "echo ${PROFILE_NAME}", expandVariables("echo ${PROFILE_NAME}", variables))
+	assert.Equal(t, "$bucket", expandVariables("$bucket", variables))
+}
+
+func TestVariables(t *testing.T) {
+	testData := []testTemplate{
+		{"toml", `
+[variables]
+host = "s3.example.com"
+bucket = "backup"
+repository = "s3:https://${host}/${bucket}"
+
+[profile]
+repository = "${repository}/{{ .Profile.Name }}"
+[profile.backup]
+tag = ["${bucket}", "{{ .Vars.host }}"]
+
+[other]
+inherit = "profile"
+[other.variables]
+bucket = "other-backup"
+`},
+		{"yaml", `---
+variables:
+  host: s3.example.com
+  bucket: backup
+  repository: "s3:https://${host}/${bucket}"
+profile:
+  repository: "${repository}/{{ .Profile.Name }}"
+  backup:
+    tag:
+      - "${bucket}"
+      - "{{ .Vars.host }}"
+other:
+  inherit: profile
+  variables:
+    bucket: other-backup
+`},
+		{"hcl", `
+variables {
+  host = "s3.example.com"
+  bucket = "backup"
+  repository = "s3:https://${host}/${bucket}"
+}
+profile {
+  repository = "${repository}/{{ .Profile.Name }}"
+  backup {
+    tag = ["${bucket}", "{{ .Vars.host }}"]
+  }
+}
+other {
+  inherit = "profile"
+  variables {
+    bucket = "other-backup"
+  }
+}
+`},
+	}
+
+	for _, testItem := range testData {
+		format := testItem.format
+		testConfig := testItem.config
+		t.Run(format, func(t *testing.T) {
+			c, err := Load(bytes.NewBufferString(testConfig), format)
+			require.NoError(t, err)
+
+			assert.NotContains(t, c.GetProfileSections(), "variables")
+
+			profile, err := c.GetProfile("profile", "backup")
+			require.NoError(t, err)
+			require.NotNil(t, profile)
+			assert.Equal(t, "s3:https://s3.example.com/backup/profile", profile.Repository)
+			assert.ElementsMatch(t, []string{"backup", "s3.example.com"}, profile.Backup.OtherFlags["tag"])
+
+			profile, err = c.GetProfile("other", "backup")
+			require.NoError(t, err)
+			require.NotNil(t, profile)
+			assert.Equal(t, "s3:https://s3.example.com/other-backup/other", profile.Repository)
+			assert.ElementsMatch(t, []string{"other-backup", "s3.example.com"}, profile.Backup.OtherFlags["tag"])
+		})
+	}
+}
+
+func TestUndefinedVariable(t *testing.T) {
+	testConfig := `
+[variables]
+bucket = "${TEST_UNDEFINED_VARIABLE}"
+`
+	_, err := Load(bytes.NewBufferString(testConfig), "toml")
+	assert.EqualError(t, err, "variable 'bucket': undefined reference to '${TEST_UNDEFINED_VARIABLE}'")
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/creativeprojects/clog"
+	"github.com/creativeprojects/resticprofile/config"
+	"github.com/creativeprojects/resticprofile/constants"
+	"github.com/creativeprojects/resticprofile/filesearch"
+)
+
+// isURL returns true when the configuration is downloaded from a web server
+func isURL(configFile string) bool {
+	return strings.HasPrefix(configFile, "http://") || strings.HasPrefix(configFile, "https://")
+}
+
+// loadConfiguration loads the configuration from a file, a URL or the standard input ("-")
+func loadConfiguration(flags commandLineFlags) (*config.Config, error) {
+	if flags.config == constants.ConfigurationStdin {
+		if flags.format == "" {
+			return nil, errors.New("the format is needed to read the configuration from stdin (--format)")
+		}
+		clog.Debug("reading configuration from stdin")
+		return config.LoadSource(os.Stdin, flags.config, flags.format, flags.baseDir)
+	}
+
+	if isURL(flags.config) {
+		content, err := downloadConfiguration(flags)
+		if err != nil {
+			return nil, err
+		}
+		format := flags.format
+		if format == "" {
+			format, err = formatFromURL(flags.config)
+			if err != nil {
+				return nil, err
+			}
+		}
+		baseDir := flags.baseDir
+		if baseDir == "" {
+			// there's no directory to speak of: relative paths are from the current directory
+			baseDir = "."
+		}
+		return config.LoadSource(bytes.NewReader(content), flags.config, format, baseDir)
+	}
+
+	configFile, err := filesearch.FindConfigurationFile(flags.config)
+	if err != nil {
+		return nil, err
+	}
+	if configFile != flags.config {
+		clog.Infof("using configuration file: %s", configFile)
+	}
+	if flags.baseDir == "" {
+		return config.LoadFile(configFile, flags.format)
+	}
+	file, err := os.Open(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open configuration file for reading: %w", err)
+	}
+	defer file.Close()
+	return config.LoadSource(file, configFile, flags.format, flags.baseDir)
+}
+
+// configurationArgs returns the flags needed to load the same configuration again, from a scheduled job for example.
+// The paths are relative to the current directory, which is also the working directory of the job
+func configurationArgs(flags commandLineFlags) []string {
+	args := []string{"--config", flags.config}
+	if flags.format != "" {
+		args = append(args, "--format", flags.format)
+	}
+	if flags.baseDir != "" {
+		args = append(args, "--base-dir", flags.baseDir)
+	}
+	if !isURL(flags.config) {
+		return args
+	}
+	if flags.configCache != "" {
+		args = append(args, "--config-cache", flags.configCache)
+	}
+	if flags.tlsCert != "" {
+		args = append(args, "--tls-cert", flags.tlsCert)
+	}
+	if flags.tlsKey != "" {
+		args = append(args, "--tls-key", flags.tlsKey)
+	}
+	if flags.tlsCA != "" {
+		args = append(args, "--tls-ca", flags.tlsCA)
+	}
+	return args
+}
+
+// formatFromURL returns the extension of the file in the URL
+func formatFromURL(configURL string) (string, error) {
+	parsed, err := url.Parse(configURL)
+	if err != nil {
+		return "", err
+	}
+	format := strings.TrimPrefix(path.Ext(parsed.Path), ".")
+	if format == "" {
+		return "", fmt.Errorf("cannot find the format of the configuration from '%s': please use the --format flag", configURL)
+	}
+	return format, nil
+}
+
+// downloadConfiguration returns the content of the configuration at the URL.
+//
+// When a cache directory is specified, the configuration is only downloaded again when the server
+// sends a different ETag. The cached copy is also used when the server cannot be reached.
+func downloadConfiguration(flags commandLineFlags) ([]byte, error) {
+	client, err := newHTTPClient(flags.tlsCert, flags.tlsKey, flags.tlsCA)
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest(http.MethodGet, flags.config, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var cache *configurationCache
+	if flags.configCache != "" {
+		cache = newConfigurationCache(flags.configCache, flags.config)
+		if cache.load() && cache.etag != "" {
+			request.Header.Set("If-None-Match", cache.etag)
+		}
+	}
+
+	clog.Debugf("downloading configuration from %s", flags.config)
+	response, err := client.Do(request)
+	if err != nil {
+		return cache.fallback(fmt.Errorf("cannot download configuration: %w", err))
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotModified && cache != nil && cache.content != nil {
+		clog.Debugf("configuration not modified, using cached copy")
+		return cache.content, nil
+	}
+	if response.StatusCode != http.StatusOK {
+		return cache.fallback(fmt.Errorf("cannot download configuration: %s", response.Status))
+	}
+	content, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return cache.fallback(fmt.Errorf("cannot download configuration: %w", err))
+	}
+	if cache != nil {
+		err = cache.save(content, response.Header.Get("ETag"))
+		if err != nil {
+			clog.Warningf("cannot save configuration in cache: %v", err)
+		}
+	}
+	return content, nil
+}
+
+// newHTTPClient creates a HTTP client with an optional client certificate and certificate authority
+func newHTTPClient(certFile, keyFile, caFile string) (*http.Client, error) {
+	tlsConfig := &tls.Config{}
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, errors.New("both the client certificate (--tls-cert) and its key (--tls-key) are needed")
+		}
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	if caFile != "" {
+		caCert, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load certificate authority: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificate found in '%s'", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{
+		Transport: transport,
+		Timeout:   constants.DefaultDownloadTimeout,
+	}, nil
+}
+
+// configurationCache is a local copy of a configuration downloaded from a URL
+type configurationCache struct {
+	contentFile string
+	etagFile    string
+	content     []byte
+	etag        string
+}
+
+func newConfigurationCache(dir, configURL string) *configurationCache {
+	hash := sha256.Sum256([]byte(configURL))
+	name := hex.EncodeToString(hash[:])
+	return &configurationCache{
+		contentFile: filepath.Join(dir, name+".conf"),
+		etagFile:    filepath.Join(dir, name+".etag"),
+	}
+}
+
+// load returns true when a cached copy was found
+func (c *configurationCache) load() bool {
+	content, err := ioutil.ReadFile(c.contentFile)
+	if err != nil {
+		return false
+	}
+	c.content = content
+	etag, err := ioutil.ReadFile(c.etagFile)
+	if err == nil {
+		c.etag = strings.TrimSpace(string(etag))
+	}
+	return true
+}
+
+func (c *configurationCache) save(content []byte, etag string) error {
+	err := os.MkdirAll(filepath.Dir(c.contentFile), 0700)
+	if err != nil {
+		return err
+	}
+	// the configuration might contain some secrets
+	err = ioutil.WriteFile(c.contentFile, content, 0600)
+	if err != nil {
+		return err
+	}
+	if etag == "" {
+		err = os.Remove(c.etagFile)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return ioutil.WriteFile(c.etagFile, []byte(etag), 0600)
+}
+
+// fallback returns the cached copy (if any) when the configuration cannot be downloaded
+func (c *configurationCache) fallback(err error) ([]byte, error) {
+	if c == nil || c.content == nil {
+		return nil, err
+	}
+	clog.Warningf("%v: using cached copy", err)
+	return c.content, nil
+}
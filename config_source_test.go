@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRemoteConfiguration = `
+[remote]
+repository = "/srv/backup"
+password-file = "key"
+`
+
+func TestFormatFromURL(t *testing.T) {
+	testData := []struct {
+		url    string
+		format string
+	}{
+		{"https://config-server/profiles.toml", "toml"},
+		{"https://config-server/path/profiles.yaml?version=2", "yaml"},
+		{"http://config-server/profiles.conf#section", "conf"},
+		{"https://config-server/profiles", ""},
+	}
+	for _, testItem := range testData {
+		t.Run(testItem.url, func(t *testing.T) {
+			format, err := formatFromURL(testItem.url)
+			if testItem.format == "" {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, testItem.format, format)
+		})
+	}
+}
+
+func TestConfigurationArgs(t *testing.T) {
+	flags := commandLineFlags{
+		config:      "profiles.conf",
+		baseDir:     "/srv",
+		configCache: "cache",
+		tlsCert:     "cert.pem",
+	}
+	assert.Equal(t, []string{"--config", "profiles.conf", "--base-dir", "/srv"}, configurationArgs(flags))
+
+	flags.config = "https://config-server/profiles"
+	flags.format = "toml"
+	assert.Equal(t, []string{
+		"--config", "https://config-server/profiles",
+		"--format", "toml",
+		"--base-dir", "/srv",
+		"--config-cache", "cache",
+		"--tls-cert", "cert.pem",
+	}, configurationArgs(flags))
+}
+
+func TestLoadConfigurationFromURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(testRemoteConfiguration))
+	}))
+	defer server.Close()
+
+	c, err := loadConfiguration(commandLineFlags{config: server.URL + "/profiles.toml", baseDir: "/srv"})
+	require.NoError(t, err)
+
+	profile, err := c.GetProfile("remote", "")
+	require.NoError(t, err)
+	require.NotNil(t, profile)
+	profile.SetRootPath(c.GetBaseDir())
+	assert.Equal(t, "/srv/backup", profile.Repository)
+	assert.Equal(t, filepath.Join("/srv", "key"), profile.PasswordFile)
+}
+
+func TestDownloadConfigurationWithCache(t *testing.T) {
+	downloads := 0
+	serverDown := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if serverDown {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		_, _ = w.Write([]byte(testRemoteConfiguration))
+	}))
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "resticprofile-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	flags := commandLineFlags{config: server.URL + "/profiles.toml", configCache: cacheDir}
+
+	// first download saves the configuration in cache
+	content, err := downloadConfiguration(flags)
+	require.NoError(t, err)
+	assert.Equal(t, testRemoteConfiguration, string(content))
+	assert.Equal(t, 1, downloads)
+
+	// not modified
+	content, err = downloadConfiguration(flags)
+	require.NoError(t, err)
+	assert.Equal(t, testRemoteConfiguration, string(content))
+	assert.Equal(t, 1, downloads)
+
+	// the cached copy is used when the server is not available
+	serverDown = true
+	content, err = downloadConfiguration(flags)
+	require.NoError(t, err)
+	assert.Equal(t, testRemoteConfiguration, string(content))
+
+	// but not without a cache
+	flags.configCache = ""
+	_, err = downloadConfiguration(flags)
+	assert.Error(t, err)
+}
+
+func TestDownloadConfigurationWithCertificateAuthority(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(testRemoteConfiguration))
+	}))
+	defer server.Close()
+
+	flags := commandLineFlags{config: server.URL + "/profiles.toml"}
+
+	// the certificate of the test server is not trusted by default
+	_, err := downloadConfiguration(flags)
+	assert.Error(t, err)
+
+	caFile, err := ioutil.TempFile("", "resticprofile-ca")
+	require.NoError(t, err)
+	defer os.Remove(caFile.Name())
+	err = pem.Encode(caFile, &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, err)
+	caFile.Close()
+
+	flags.tlsCA = caFile.Name()
+	content, err := downloadConfiguration(flags)
+	require.NoError(t, err)
+	assert.Equal(t, testRemoteConfiguration, string(content))
+}
+
+func TestClientCertificateNeedsKey(t *testing.T) {
+	_, err := newHTTPClient("cert.pem", "", "")
+	assert.Error(t, err)
+}
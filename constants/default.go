@@ -1,15 +1,25 @@
 package constants
 
+import "time"
+
 // Configuration defaults
 const (
-	DefaultConfigurationFile = "profiles"
-	DefaultProfileName       = "default"
-	DefaultCommand           = "snapshots"
-	DefaultResticBinary      = "restic"
-	DefaultTheme             = "light"
-	DefaultIONiceFlag        = false
-	DefaultNiceFlag          = 0
-	DefaultVerboseFlag       = false
-	DefaultQuietFlag         = false
-	DefaultMinMemory         = 100
+	DefaultConfigurationFile  = "profiles"
+	DefaultProfileName        = "default"
+	DefaultCommand            = "snapshots"
+	DefaultResticBinary       = "restic"
+	DefaultTheme              = "light"
+	DefaultIONiceFlag         = false
+	DefaultNiceFlag           = 0
+	DefaultVerboseFlag        = false
+	DefaultQuietFlag          = false
+	DefaultMinMemory          = 100
+	DefaultDownloadTimeout    = 30 * time.Second
+	DefaultWatchDelay         = 2 * time.Second
+	DefaultRetryDelay         = time.Minute
+	DefaultRetryBackoffFactor = 2.0
+	DefaultTimeoutGracePeriod = 10 * time.Second
 )
+
+// ConfigurationStdin is the name of the configuration file when reading from the standard input
+const ConfigurationStdin = "-"
@@ -0,0 +1,7 @@
+package constants
+
+// Environment variables
+const (
+	EnvResticPassword = "RESTIC_PASSWORD"
+	EnvOverridePrefix = "RESTICPROFILE_"
+)
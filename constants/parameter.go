@@ -2,15 +2,16 @@ package constants
 
 // Parameter
 const (
-	ParameterIONice         = "ionice"
-	ParameterIONiceClass    = "ionice-class"
-	ParameterIONiceLevel    = "ionice-level"
-	ParameterNice           = "nice"
-	ParameterPriority       = "priority"
-	ParameterDefaultCommand = "default-command"
-	ParameterInitialize     = "initialize"
-	ParameterResticBinary   = "restic-binary"
-	ParameterInherit        = "inherit"
-	ParameterHost           = "host"
-	ParameterPath           = "path"
+	ParameterIONice          = "ionice"
+	ParameterIONiceClass     = "ionice-class"
+	ParameterIONiceLevel     = "ionice-level"
+	ParameterNice            = "nice"
+	ParameterPriority        = "priority"
+	ParameterDefaultCommand  = "default-command"
+	ParameterInitialize      = "initialize"
+	ParameterResticBinary    = "restic-binary"
+	ParameterInherit         = "inherit"
+	ParameterHost            = "host"
+	ParameterPath            = "path"
+	ParameterPasswordCommand = "password-command"
 )
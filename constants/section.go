@@ -6,6 +6,7 @@ const (
 	SectionConfigurationRetention   = "retention"
 	SectionConfigurationEnvironment = "env"
 	SectionConfigurationGroups      = "groups"
+	SectionConfigurationVariables   = "variables"
 
 	SectionDefinitionCommon = "common"
 	SectionDefinitionForget = "forget"
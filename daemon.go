@@ -0,0 +1,433 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/creativeprojects/clog"
+	"github.com/creativeprojects/resticprofile/calendar"
+	"github.com/creativeprojects/resticprofile/config"
+	"github.com/creativeprojects/resticprofile/filesearch"
+	"github.com/creativeprojects/resticprofile/remote"
+	"github.com/spf13/pflag"
+)
+
+// maxDaemonSleep is the longest time the daemon waits before checking the clock again
+// (the wall clock can jump after the system was suspended, or after a time adjustment)
+const maxDaemonSleep = time.Minute
+
+// daemonJob is a scheduled command of a profile, run by the daemon
+type daemonJob struct {
+	profileName string
+	command     string
+	events      []*calendar.Event
+	next        time.Time
+	pending     bool
+}
+
+// daemonResult is sent when a job has finished
+type daemonResult struct {
+	job *daemonJob
+	err error
+}
+
+// runningJob is a job started by the daemon
+type runningJob struct {
+	job     *daemonJob
+	sigChan chan os.Signal
+	started time.Time
+}
+
+// daemonState is saved between runs of the daemon, to catch up with the jobs missed while it wasn't running
+type daemonState struct {
+	LastRuns map[string]time.Time `json:"last-runs"`
+}
+
+// daemon runs the scheduled jobs in-process, at the right time
+type daemon struct {
+	jobs      []*daemonJob
+	state     daemonState
+	stateFile string
+	// prepareJob returns the function running the job in the background.
+	// The signal channel receives a signal when the daemon is stopping
+	prepareJob func(job *daemonJob, sigChan chan os.Signal) (func() error, error)
+	running    map[string]*runningJob
+	finished   chan daemonResult
+	// control receives the functions to run from the daemon loop (to access the jobs and the configuration safely)
+	control chan func()
+	// stopped is closed when the daemon loop has returned
+	stopped chan struct{}
+	now     func() time.Time
+}
+
+// runDaemon runs the scheduled jobs of all the profiles, without the help of systemd, launchd or the windows task scheduler
+func runDaemon(c *config.Config, flags commandLineFlags, args []string) error {
+	stateFile := ""
+	apiAddress := ""
+	apiTokenFile := ""
+	flagset := pflag.NewFlagSet("daemon", pflag.ContinueOnError)
+	flagset.StringVar(&stateFile, "state-file", "", "file keeping the time of the last run of each job (default in the user data directory)")
+	flagset.StringVar(&apiAddress, "api", "", "start the HTTP API on this address (like 127.0.0.1:8080)")
+	flagset.StringVar(&apiTokenFile, "api-token-file", "", "file containing the token to authenticate the API requests")
+	err := flagset.Parse(args)
+	if err != nil {
+		return err
+	}
+	apiToken := ""
+	if apiAddress != "" {
+		apiToken, err = loadAPIToken(apiTokenFile)
+		if err != nil {
+			return err
+		}
+	}
+	if stateFile == "" {
+		stateFile, err = xdg.DataFile(filepath.Join("resticprofile", "daemon.json"))
+		if err != nil {
+			return err
+		}
+	}
+
+	global, err := c.GetGlobalSection()
+	if err != nil {
+		return fmt.Errorf("cannot load global configuration: %w", err)
+	}
+	resticBinary, err := filesearch.FindResticBinary(global.ResticBinary)
+	if err != nil {
+		return fmt.Errorf("cannot find restic: %w", err)
+	}
+
+	schedules, err := loadSchedules(c)
+	if err != nil {
+		return err
+	}
+	jobs, err := newDaemonJobs(schedules)
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		return fmt.Errorf("no schedule found in configuration file '%s'", c.GetConfigFile())
+	}
+
+	d := newDaemon(jobs, stateFile, func(job *daemonJob, sigChan chan os.Signal) (func() error, error) {
+		resticCommand := getResticCommand(job.command)
+		profile, err := loadProfile(c, flags, job.profileName, resticCommand)
+		if err != nil {
+			return nil, err
+		}
+		wrapper := newResticWrapper(
+			resticBinary,
+			global.Initialize || profile.Initialize,
+			flags.dryRun,
+			profile,
+			resticCommand,
+			nil,
+			sigChan,
+		)
+		return wrapper.runProfile, nil
+	})
+
+	if apiAddress != "" {
+		api := remote.NewAPIServer(apiToken, &daemonController{daemon: d, config: c, flags: flags})
+		err = api.Start(apiAddress)
+		if err != nil {
+			return fmt.Errorf("cannot start API: %w", err)
+		}
+		defer api.Stop()
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	d.run(stop)
+	return nil
+}
+
+// newDaemonJobs returns the jobs of all the schedule configurations, in the order of their keys
+func newDaemonJobs(schedules map[string]*config.ScheduleConfig) ([]*daemonJob, error) {
+	jobs := make([]*daemonJob, 0, len(schedules))
+	for _, key := range sortedScheduleKeys(schedules) {
+		scheduleConfig := schedules[key]
+		job := &daemonJob{
+			profileName: scheduleConfig.Title(),
+			command:     scheduleConfig.SubTitle(),
+			events:      make([]*calendar.Event, 0, len(scheduleConfig.Schedules())),
+		}
+		for _, schedule := range scheduleConfig.Schedules() {
+			event := calendar.NewEvent()
+			err := event.Parse(schedule)
+			if err != nil {
+				return nil, fmt.Errorf("invalid schedule '%s' for %s: %w", schedule, key, err)
+			}
+			job.events = append(job.events, event)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (j *daemonJob) key() string {
+	return j.profileName + "/" + j.command
+}
+
+// nextRun returns the first activation of the job at or after the time in parameter.
+// It returns a zero time if the job won't run again
+func (j *daemonJob) nextRun(from time.Time) time.Time {
+	next := time.Time{}
+	for _, event := range j.events {
+		eventNext := event.Next(from)
+		if eventNext.IsZero() {
+			continue
+		}
+		if next.IsZero() || eventNext.Before(next) {
+			next = eventNext
+		}
+	}
+	return next
+}
+
+// missedRun returns true when the job should have run between its last run and now
+func (j *daemonJob) missedRun(lastRun, now time.Time) bool {
+	if lastRun.IsZero() {
+		return false
+	}
+	next := j.nextRun(lastRun.Add(time.Minute))
+	return !next.IsZero() && !next.After(now)
+}
+
+func newDaemon(jobs []*daemonJob, stateFile string, prepareJob func(job *daemonJob, sigChan chan os.Signal) (func() error, error)) *daemon {
+	return &daemon{
+		jobs:       jobs,
+		state:      daemonState{LastRuns: make(map[string]time.Time)},
+		stateFile:  stateFile,
+		prepareJob: prepareJob,
+		running:    make(map[string]*runningJob),
+		finished:   make(chan daemonResult),
+		control:    make(chan func()),
+		stopped:    make(chan struct{}),
+		now:        time.Now,
+	}
+}
+
+// run the jobs until a signal is received on the stop channel.
+// The running jobs receive the signal, and the daemon waits until they're all finished before returning
+func (d *daemon) run(stop chan os.Signal) {
+	defer close(d.stopped)
+	d.loadState()
+	now := d.now()
+	for _, job := range d.jobs {
+		if lastRun, found := d.state.LastRuns[job.key()]; found && job.missedRun(lastRun, now) {
+			clog.Infof("job %s missed a run since %s: starting now", job.key(), lastRun.Format(time.RFC3339))
+			job.pending = true
+		}
+		job.next = job.nextRun(now)
+		clog.Infof("job %s: next run at %s", job.key(), job.next.Format(time.RFC3339))
+	}
+	d.startPendingJobs()
+
+	for {
+		timer := time.NewTimer(d.sleepDuration())
+		select {
+		case <-timer.C:
+			d.triggerJobs()
+			d.startPendingJobs()
+
+		case result := <-d.finished:
+			timer.Stop()
+			delete(d.running, result.job.profileName)
+			if result.err != nil {
+				clog.Errorf("job %s failed: %v", result.job.key(), result.err)
+			} else {
+				clog.Infof("job %s finished", result.job.key())
+			}
+			d.startPendingJobs()
+
+		case request := <-d.control:
+			timer.Stop()
+			request()
+
+		case sig := <-stop:
+			timer.Stop()
+			clog.Infof("stopping daemon: waiting for %d running job(s)", len(d.running))
+			for _, running := range d.running {
+				running.signal(sig)
+			}
+			for len(d.running) > 0 {
+				select {
+				case result := <-d.finished:
+					delete(d.running, result.job.profileName)
+				case request := <-d.control:
+					request()
+				}
+			}
+			return
+		}
+	}
+}
+
+// sleepDuration returns the time until the next job is due
+func (d *daemon) sleepDuration() time.Duration {
+	now := d.now()
+	sleep := maxDaemonSleep
+	for _, job := range d.jobs {
+		if job.next.IsZero() {
+			continue
+		}
+		if until := job.next.Sub(now); until < sleep {
+			sleep = until
+		}
+	}
+	if sleep < 0 {
+		return 0
+	}
+	return sleep
+}
+
+// triggerJobs flags all the jobs due to run, and calculates their next run
+func (d *daemon) triggerJobs() {
+	now := d.now()
+	for _, job := range d.jobs {
+		if job.next.IsZero() || job.next.After(now) {
+			continue
+		}
+		if job.pending {
+			clog.Warningf("job %s is still waiting for the previous run of profile '%s' to finish", job.key(), job.profileName)
+		}
+		job.pending = true
+		job.next = job.nextRun(now.Truncate(time.Minute).Add(time.Minute))
+	}
+}
+
+// startPendingJobs starts all the pending jobs, except for the profiles which are already running
+func (d *daemon) startPendingJobs() {
+	for _, job := range d.jobs {
+		if !job.pending {
+			continue
+		}
+		if _, found := d.running[job.profileName]; found {
+			// wait until the current job of the profile has finished
+			continue
+		}
+		job.pending = false
+		err := d.startJob(job)
+		if err != nil {
+			clog.Errorf("cannot start job %s: %v", job.key(), err)
+		}
+	}
+}
+
+// startJob runs the job in the background
+func (d *daemon) startJob(job *daemonJob) error {
+	sigChan := make(chan os.Signal, 1)
+	run, err := d.prepareJob(job, sigChan)
+	if err != nil {
+		return err
+	}
+	clog.Infof("starting job %s", job.key())
+	d.running[job.profileName] = &runningJob{
+		job:     job,
+		sigChan: sigChan,
+		started: d.now(),
+	}
+	d.state.LastRuns[job.key()] = d.now()
+	d.saveState()
+	go func() {
+		d.finished <- daemonResult{job: job, err: run()}
+	}()
+	return nil
+}
+
+// do runs the function from the daemon loop, and waits until it's finished.
+// It returns remote.ErrUnavailable without running the function once the daemon has stopped
+func (d *daemon) do(request func() error) error {
+	var err error
+	done := make(chan bool)
+	select {
+	case d.control <- func() {
+		err = request()
+		close(done)
+	}:
+	case <-d.stopped:
+		return fmt.Errorf("daemon stopped: %w", remote.ErrUnavailable)
+	}
+	<-done
+	return err
+}
+
+// signal sends the signal to the job, unless it already received one
+func (r *runningJob) signal(sig os.Signal) {
+	select {
+	case r.sigChan <- sig:
+	default:
+	}
+}
+
+func (d *daemon) loadState() {
+	if d.stateFile == "" {
+		return
+	}
+	content, err := ioutil.ReadFile(d.stateFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			clog.Warningf("cannot read daemon state: %v", err)
+		}
+		return
+	}
+	state := daemonState{}
+	err = json.Unmarshal(content, &state)
+	if err != nil {
+		clog.Warningf("cannot read daemon state: %v", err)
+		return
+	}
+	for key, lastRun := range state.LastRuns {
+		d.state.LastRuns[key] = lastRun
+	}
+}
+
+// saveState writes the state into a temporary file renamed over the state file,
+// so the daemon never reads a truncated state after a crash during the save
+func (d *daemon) saveState() {
+	if d.stateFile == "" {
+		return
+	}
+	err := d.writeState()
+	if err != nil {
+		clog.Warningf("cannot save daemon state: %v", err)
+	}
+}
+
+func (d *daemon) writeState() error {
+	content, err := json.MarshalIndent(d.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir, name := filepath.Split(d.stateFile)
+	if dir == "" {
+		dir = "."
+	}
+	file, err := ioutil.TempFile(dir, name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tempFile := file.Name()
+	_, err = file.Write(content)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempFile, d.stateFile)
+	}
+	if err != nil {
+		_ = os.Remove(tempFile)
+		return err
+	}
+	return nil
+}
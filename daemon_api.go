@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/creativeprojects/resticprofile/config"
+	"github.com/creativeprojects/resticprofile/constants"
+	"github.com/creativeprojects/resticprofile/lock"
+	"github.com/creativeprojects/resticprofile/remote"
+	"github.com/creativeprojects/resticprofile/status"
+)
+
+// daemonController gives access to the daemon from the HTTP API.
+// All the methods are running from the daemon loop
+type daemonController struct {
+	daemon *daemon
+	config *config.Config
+	flags  commandLineFlags
+}
+
+// loadAPIToken reads the token from the file
+func loadAPIToken(tokenFile string) (string, error) {
+	if tokenFile == "" {
+		return "", errors.New("the API needs a token to authenticate the requests (--api-token-file)")
+	}
+	content, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		return "", fmt.Errorf("cannot read API token: %w", err)
+	}
+	token := strings.TrimSpace(string(content))
+	if token == "" {
+		return "", fmt.Errorf("API token file '%s' is empty", tokenFile)
+	}
+	return token, nil
+}
+
+// Profiles returns all the profiles with their scheduled jobs
+func (c *daemonController) Profiles() (profiles []remote.ProfileInfo, err error) {
+	err = c.daemon.do(func() error {
+		names := make([]string, 0)
+		for name := range c.config.GetProfileSections() {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		profiles = make([]remote.ProfileInfo, len(names))
+		for i, name := range names {
+			profiles[i] = remote.ProfileInfo{Name: name}
+			for _, job := range c.daemon.jobs {
+				if job.profileName != name {
+					continue
+				}
+				schedule := remote.ScheduleInfo{Command: job.command}
+				if !job.next.IsZero() {
+					next := job.next
+					schedule.Next = &next
+				}
+				if lastRun, found := c.daemon.state.LastRuns[job.key()]; found {
+					schedule.LastRun = &lastRun
+				}
+				profiles[i].Schedules = append(profiles[i].Schedules, schedule)
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// ProfileStatus returns the content of the status file of the profile
+func (c *daemonController) ProfileStatus(profileName string) (profileStatus *status.Profile, err error) {
+	err = c.daemon.do(func() error {
+		profile, err := c.loadProfile(profileName)
+		if err != nil {
+			return err
+		}
+		if profile.StatusFile == "" {
+			return fmt.Errorf("no status file in profile '%s': %w", profileName, remote.ErrNotFound)
+		}
+		profileStatus = status.NewStatus(profile.StatusFile).Load().Profile(profileName)
+		return nil
+	})
+	return
+}
+
+// Jobs returns the jobs started by the daemon, and the profiles locked by another process
+func (c *daemonController) Jobs() (jobs []remote.JobInfo, err error) {
+	err = c.daemon.do(func() error {
+		jobs = make([]remote.JobInfo, 0)
+		names := make([]string, 0)
+		for name := range c.config.GetProfileSections() {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			job := remote.JobInfo{Profile: name}
+			running, isRunning := c.daemon.running[name]
+			if isRunning {
+				started := running.started
+				job.Command = running.job.command
+				job.Started = &started
+			}
+			profile, err := c.loadProfile(name)
+			if err == nil && profile.Lock != "" {
+				profileLock := lock.NewLock(profile.Lock)
+				if who, err := profileLock.Who(); err == nil {
+					job.LockedBy = who
+					isRunning = true
+					if pid, err := profileLock.LastPID(); err == nil {
+						job.PID = pid
+					}
+				}
+			}
+			if isRunning {
+				jobs = append(jobs, job)
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// Start runs the command of the profile now, unless the profile is already running
+func (c *daemonController) Start(profileName, command string) error {
+	return c.daemon.do(func() error {
+		sections, found := c.config.GetProfileSections()[profileName]
+		if !found {
+			return fmt.Errorf("profile '%s': %w", profileName, remote.ErrNotFound)
+		}
+		if !isStartableCommand(command, sections) {
+			return fmt.Errorf("command '%s' of profile '%s': %w", command, profileName, remote.ErrInvalidCommand)
+		}
+		if _, found := c.daemon.running[profileName]; found {
+			return fmt.Errorf("profile '%s': %w", profileName, remote.ErrConflict)
+		}
+		job := &daemonJob{profileName: profileName, command: command}
+		for _, scheduledJob := range c.daemon.jobs {
+			if scheduledJob.key() == job.key() {
+				job = scheduledJob
+				break
+			}
+		}
+		// a scheduled job waiting to start runs now: it mustn't start again once finished
+		job.pending = false
+		return c.daemon.startJob(job)
+	})
+}
+
+// Cancel interrupts the job of the profile started by the daemon.
+// A profile started by another process is never interrupted: the PID in its lock file can be stale
+func (c *daemonController) Cancel(profileName string) error {
+	return c.daemon.do(func() error {
+		running, found := c.daemon.running[profileName]
+		if !found {
+			return fmt.Errorf("no job started by the daemon for profile '%s': %w", profileName, remote.ErrNotFound)
+		}
+		running.signal(os.Interrupt)
+		return nil
+	})
+}
+
+func (c *daemonController) loadProfile(profileName string) (*config.Profile, error) {
+	if !c.config.HasProfile(profileName) {
+		return nil, fmt.Errorf("profile '%s': %w", profileName, remote.ErrNotFound)
+	}
+	return loadProfile(c.config, c.flags, profileName, "")
+}
+
+// isStartableCommand returns true for the restic commands, and for the sections defined in the profile
+func isStartableCommand(command string, profileSections []string) bool {
+	switch command {
+	case constants.CommandBackup,
+		constants.CommandCheck,
+		constants.CommandForget,
+		constants.CommandInit,
+		constants.CommandPrune,
+		constants.CommandSnapshots,
+		constants.CommandCopy:
+		return true
+	case constants.SectionConfigurationEnvironment:
+		return false
+	}
+	for _, section := range profileSections {
+		if section == command {
+			return true
+		}
+	}
+	return false
+}
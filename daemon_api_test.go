@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/creativeprojects/resticprofile/config"
+	"github.com/creativeprojects/resticprofile/remote"
+	"github.com/creativeprojects/resticprofile/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadAPIToken(t *testing.T) {
+	_, err := loadAPIToken("")
+	assert.Error(t, err)
+
+	tokenFile, err := ioutil.TempFile("", "resticprofile-token")
+	require.NoError(t, err)
+	defer os.Remove(tokenFile.Name())
+	_, err = tokenFile.WriteString("  \n")
+	require.NoError(t, err)
+	tokenFile.Close()
+
+	_, err = loadAPIToken(tokenFile.Name())
+	assert.Error(t, err)
+
+	err = ioutil.WriteFile(tokenFile.Name(), []byte("secret\n"), 0600)
+	require.NoError(t, err)
+	token, err := loadAPIToken(tokenFile.Name())
+	require.NoError(t, err)
+	assert.Equal(t, "secret", token)
+}
+
+func TestDaemonController(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resticprofile-api")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	statusFile := filepath.Join(dir, "status.json")
+	profileStatus := status.NewStatus(statusFile)
+	profileStatus.Profile("root").BackupSuccess()
+	require.NoError(t, profileStatus.Save())
+
+	c, err := config.Load(bytes.NewBufferString(fmt.Sprintf(`
+[root]
+status-file = %q
+
+[root.backup]
+schedule = "daily"
+
+[other]
+lock = %q
+`, statusFile, filepath.Join(dir, "other.lock"))), "toml")
+	require.NoError(t, err)
+	schedules, err := loadSchedules(c)
+	require.NoError(t, err)
+	jobs, err := newDaemonJobs(schedules)
+	require.NoError(t, err)
+
+	started := make(chan string, 1)
+	d := newDaemon(jobs, "", func(job *daemonJob, sigChan chan os.Signal) (func() error, error) {
+		return func() error {
+			started <- job.key()
+			<-sigChan
+			return errors.New("interrupted")
+		}, nil
+	})
+	controller := &daemonController{daemon: d, config: c}
+
+	stop := make(chan os.Signal, 1)
+	done := make(chan bool)
+	go func() {
+		d.run(stop)
+		done <- true
+	}()
+	defer func() {
+		stop <- os.Interrupt
+		<-done
+	}()
+
+	profiles, err := controller.Profiles()
+	require.NoError(t, err)
+	require.Len(t, profiles, 2)
+	assert.Equal(t, "other", profiles[0].Name)
+	assert.Empty(t, profiles[0].Schedules)
+	assert.Equal(t, "root", profiles[1].Name)
+	require.Len(t, profiles[1].Schedules, 1)
+	assert.Equal(t, "backup", profiles[1].Schedules[0].Command)
+	assert.NotNil(t, profiles[1].Schedules[0].Next)
+
+	rootStatus, err := controller.ProfileStatus("root")
+	require.NoError(t, err)
+	require.NotNil(t, rootStatus.Command("backup"))
+	assert.True(t, rootStatus.Command("backup").Success)
+
+	_, err = controller.ProfileStatus("other")
+	assert.True(t, errors.Is(err, remote.ErrNotFound))
+
+	err = controller.Start("unknown", "backup")
+	assert.True(t, errors.Is(err, remote.ErrNotFound))
+
+	runningJobs, err := controller.Jobs()
+	require.NoError(t, err)
+	assert.Empty(t, runningJobs)
+
+	err = controller.Start("root", "check")
+	require.NoError(t, err)
+	assert.Equal(t, "root/check", <-started)
+
+	err = controller.Start("root", "backup")
+	assert.True(t, errors.Is(err, remote.ErrConflict))
+
+	runningJobs, err = controller.Jobs()
+	require.NoError(t, err)
+	require.Len(t, runningJobs, 1)
+	assert.Equal(t, "root", runningJobs[0].Profile)
+	assert.Equal(t, "check", runningJobs[0].Command)
+
+	// the profile is locked by another process
+	err = ioutil.WriteFile(filepath.Join(dir, "other.lock"), []byte("someone\n123"), 0600)
+	require.NoError(t, err)
+	runningJobs, err = controller.Jobs()
+	require.NoError(t, err)
+	require.Len(t, runningJobs, 2)
+	assert.Equal(t, "other", runningJobs[0].Profile)
+	assert.Equal(t, "someone", runningJobs[0].LockedBy)
+	assert.Equal(t, int32(123), runningJobs[0].PID)
+
+	err = controller.Cancel("root")
+	require.NoError(t, err)
+	err = controller.Cancel("unknown")
+	assert.True(t, errors.Is(err, remote.ErrNotFound))
+}
+
+func TestDaemonControllerStartPendingJob(t *testing.T) {
+	c, err := config.Load(bytes.NewBufferString(`
+[root.backup]
+schedule = "daily"
+`), "toml")
+	require.NoError(t, err)
+	schedules, err := loadSchedules(c)
+	require.NoError(t, err)
+	jobs, err := newDaemonJobs(schedules)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	backup := jobs[0]
+
+	started := make(chan string, 2)
+	d := newDaemon(jobs, "", func(job *daemonJob, sigChan chan os.Signal) (func() error, error) {
+		return func() error {
+			started <- job.key()
+			<-sigChan
+			return errors.New("interrupted")
+		}, nil
+	})
+	controller := &daemonController{daemon: d, config: c}
+
+	stop := make(chan os.Signal, 1)
+	done := make(chan bool)
+	go func() {
+		d.run(stop)
+		done <- true
+	}()
+	defer func() {
+		stop <- os.Interrupt
+		<-done
+	}()
+
+	// the scheduled run is waiting to start
+	err = d.do(func() error {
+		backup.pending = true
+		return nil
+	})
+	require.NoError(t, err)
+
+	err = controller.Start("root", "backup")
+	require.NoError(t, err)
+	assert.Equal(t, "root/backup", <-started)
+	err = d.do(func() error {
+		assert.False(t, backup.pending)
+		return nil
+	})
+	require.NoError(t, err)
+
+	// the job doesn't start again once finished
+	require.NoError(t, controller.Cancel("root"))
+	assert.Eventually(t, func() bool {
+		runningJobs, err := controller.Jobs()
+		return err == nil && len(runningJobs) == 0
+	}, time.Second, 10*time.Millisecond)
+	assert.Empty(t, started)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/creativeprojects/resticprofile/calendar"
+	"github.com/creativeprojects/resticprofile/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDaemonJob(t *testing.T, profileName, command string, schedules ...string) *daemonJob {
+	job := &daemonJob{
+		profileName: profileName,
+		command:     command,
+	}
+	for _, schedule := range schedules {
+		event := calendar.NewEvent()
+		require.NoError(t, event.Parse(schedule))
+		job.events = append(job.events, event)
+	}
+	return job
+}
+
+func TestNewDaemonJobs(t *testing.T) {
+	schedules := loadTestSchedules(t, `
+[root.backup]
+schedule = ["daily", "12:00"]
+
+[root.check]
+schedule = "weekly"
+`)
+	jobs, err := newDaemonJobs(schedules)
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	assert.Equal(t, "root/backup", jobs[0].key())
+	assert.Len(t, jobs[0].events, 2)
+	assert.Equal(t, "root/check", jobs[1].key())
+}
+
+func TestDaemonJobNextRun(t *testing.T) {
+	job := newTestDaemonJob(t, "profile", "backup", "*-*-* 12:00", "*-*-* 02:30")
+	from := time.Date(2020, 10, 10, 8, 12, 45, 0, time.Local)
+
+	assert.Equal(t, time.Date(2020, 10, 10, 12, 0, 0, 0, time.Local), job.nextRun(from))
+	assert.Equal(t, time.Date(2020, 10, 11, 2, 30, 0, 0, time.Local), job.nextRun(time.Date(2020, 10, 10, 12, 1, 0, 0, time.Local)))
+}
+
+func TestDaemonJobMissedRun(t *testing.T) {
+	job := newTestDaemonJob(t, "profile", "backup", "*-*-* 12:00")
+	lastRun := time.Date(2020, 10, 10, 12, 0, 0, 0, time.Local)
+
+	assert.False(t, job.missedRun(time.Time{}, lastRun))
+	assert.False(t, job.missedRun(lastRun, lastRun.Add(23*time.Hour)))
+	assert.True(t, job.missedRun(lastRun, lastRun.Add(24*time.Hour)))
+	assert.True(t, job.missedRun(lastRun, lastRun.Add(72*time.Hour)))
+}
+
+func TestDaemonNoOverlappingRunsOfTheSameProfile(t *testing.T) {
+	backup := newTestDaemonJob(t, "profile", "backup", "daily")
+	check := newTestDaemonJob(t, "profile", "check", "daily")
+	other := newTestDaemonJob(t, "other", "backup", "daily")
+
+	started := make(chan string, 3)
+	release := make(chan bool)
+	d := newDaemon([]*daemonJob{backup, check, other}, "", func(job *daemonJob, sigChan chan os.Signal) (func() error, error) {
+		return func() error {
+			started <- job.key()
+			<-release
+			return nil
+		}, nil
+	})
+
+	backup.pending = true
+	check.pending = true
+	other.pending = true
+	d.startPendingJobs()
+
+	assert.ElementsMatch(t, []string{"profile/backup", "other/backup"}, []string{<-started, <-started})
+	assert.True(t, check.pending)
+	assert.Len(t, d.running, 2)
+
+	// the check of the profile starts after the backup
+	release <- true
+	release <- true
+	for i := 0; i < 2; i++ {
+		result := <-d.finished
+		delete(d.running, result.job.profileName)
+	}
+	d.startPendingJobs()
+	assert.Equal(t, "profile/check", <-started)
+	assert.False(t, check.pending)
+
+	release <- true
+	<-d.finished
+}
+
+func TestDaemonCatchUpAndStop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resticprofile-daemon")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "daemon.json")
+
+	now := time.Date(2020, 10, 10, 8, 0, 0, 0, time.Local)
+	err = ioutil.WriteFile(stateFile, []byte(`{"last-runs":{"profile/backup":"2020-10-08T00:00:00Z"}}`), 0600)
+	require.NoError(t, err)
+
+	backup := newTestDaemonJob(t, "profile", "backup", "daily")
+	check := newTestDaemonJob(t, "profile", "check", "monthly")
+	started := make(chan string, 2)
+	stopped := make(chan os.Signal, 1)
+	d := newDaemon([]*daemonJob{backup, check}, stateFile, func(job *daemonJob, sigChan chan os.Signal) (func() error, error) {
+		return func() error {
+			started <- job.key()
+			// wait for the daemon to stop
+			stopped <- <-sigChan
+			return nil
+		}, nil
+	})
+	d.now = func() time.Time { return now }
+
+	stop := make(chan os.Signal, 1)
+	done := make(chan bool)
+	go func() {
+		d.run(stop)
+		done <- true
+	}()
+
+	// the backup missed a run, the check didn't run yet
+	assert.Equal(t, "profile/backup", <-started)
+	stop <- syscall.SIGTERM
+	assert.Equal(t, syscall.SIGTERM, <-stopped)
+	<-done
+
+	assert.Equal(t, time.Date(2020, 10, 11, 0, 0, 0, 0, time.Local), backup.next)
+	assert.Equal(t, time.Date(2020, 11, 1, 0, 0, 0, 0, time.Local), check.next)
+	assert.Empty(t, started)
+
+	// the run was saved
+	state, err := ioutil.ReadFile(stateFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(state), now.Format(time.RFC3339))
+}
+
+func TestDaemonSaveState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resticprofile-daemon")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "daemon.json")
+
+	// a longer state already in the file is replaced, not overwritten in place
+	err = ioutil.WriteFile(stateFile, []byte(`{"last-runs":{"profile/backup":"2020-10-08T00:00:00Z","profile/check":"2020-10-01T00:00:00Z"}}`), 0600)
+	require.NoError(t, err)
+
+	lastRun := time.Date(2020, 10, 10, 8, 0, 0, 0, time.UTC)
+	d := newDaemon(nil, stateFile, nil)
+	d.state.LastRuns["profile/backup"] = lastRun
+	d.saveState()
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "daemon.json", files[0].Name())
+
+	d = newDaemon(nil, stateFile, nil)
+	d.loadState()
+	assert.Equal(t, map[string]time.Time{"profile/backup": lastRun}, d.state.LastRuns)
+}
+
+func TestDaemonRequestAfterStop(t *testing.T) {
+	d := newDaemon(nil, "", nil)
+	stop := make(chan os.Signal, 1)
+	stop <- syscall.SIGTERM
+	d.run(stop)
+
+	called := false
+	err := d.do(func() error {
+		called = true
+		return nil
+	})
+	assert.True(t, errors.Is(err, remote.ErrUnavailable))
+	assert.False(t, called)
+}
+
+func TestIsStartableCommand(t *testing.T) {
+	sections := []string{"backup", "env", "stats"}
+	assert.True(t, isStartableCommand("backup", sections))
+	assert.True(t, isStartableCommand("prune", sections))
+	assert.True(t, isStartableCommand("stats", sections))
+	assert.False(t, isStartableCommand("env", sections))
+	assert.False(t, isStartableCommand("self-update", sections))
+	assert.False(t, isStartableCommand("unlock", sections))
+}
@@ -0,0 +1,196 @@
+package dotenv
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	keyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+	// quoteReplacer escapes a value in double quotes
+	quoteReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`, "\r", `\r`)
+)
+
+// LookupFunc returns the value of a variable, and if it exists at all
+type LookupFunc func(key string) (string, bool)
+
+// Load reads a dotenv file from the disk.
+//
+// Variables can reference previously declared variables from the same file, or environment variables.
+// The file must not be readable by everyone (on systems supporting it).
+func Load(filename string) (map[string]string, error) {
+	err := checkPermission(filename)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values, err := Parse(file, os.LookupEnv)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return values, nil
+}
+
+// Parse reads dotenv formatted content.
+//
+// The lookup function is used to resolve references to variables not declared in the content (it can be nil)
+func Parse(input io.Reader, lookup LookupFunc) (map[string]string, error) {
+	values := make(map[string]string)
+	resolve := func(key string) (string, bool) {
+		if value, ok := values[key]; ok {
+			return value, true
+		}
+		if lookup != nil {
+			return lookup(key)
+		}
+		return "", false
+	}
+
+	scanner := bufio.NewScanner(input)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		keyValue := strings.SplitN(line, "=", 2)
+		if len(keyValue) != 2 {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineNum)
+		}
+		key := strings.TrimSpace(keyValue[0])
+		if !keyPattern.MatchString(key) {
+			return nil, fmt.Errorf("line %d: invalid variable name '%s'", lineNum, key)
+		}
+		raw := strings.TrimLeft(keyValue[1], " \t")
+
+		var value string
+		if strings.HasPrefix(raw, `'`) || strings.HasPrefix(raw, `"`) {
+			quote := raw[0]
+			content := raw[1:]
+			// quoted values can span multiple lines
+			for !hasClosingQuote(content, quote) {
+				if !scanner.Scan() {
+					return nil, fmt.Errorf("line %d: missing closing quote %c", lineNum, quote)
+				}
+				lineNum++
+				content += "\n" + scanner.Text()
+			}
+			end := closingQuote(content, quote)
+			if rest := strings.TrimSpace(content[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+				return nil, fmt.Errorf("line %d: unexpected characters after closing quote", lineNum)
+			}
+			content = content[:end]
+			if quote == '"' {
+				value = expand(unescape(content), resolve)
+			} else {
+				// no expansion inside single quotes
+				value = content
+			}
+		} else {
+			value = expand(removeComment(raw), resolve)
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// Quote returns the value in a form read back as is by Parse: in single quotes when possible,
+// or in double quotes with the backslashes, double quotes and dollar signs escaped
+func Quote(value string) string {
+	if !strings.ContainsAny(value, "'\n\r") {
+		return "'" + value + "'"
+	}
+	return `"` + quoteReplacer.Replace(value) + `"`
+}
+
+// closingQuote returns the position of the closing quote, or -1 if not found.
+// Double quotes can be escaped with a backslash
+func closingQuote(content string, quote byte) int {
+	for i := 0; i < len(content); i++ {
+		if quote == '"' && content[i] == '\\' {
+			// skip next character
+			i++
+			continue
+		}
+		if content[i] == quote {
+			return i
+		}
+	}
+	return -1
+}
+
+func hasClosingQuote(content string, quote byte) bool {
+	return closingQuote(content, quote) > -1
+}
+
+// removeComment strips an inline comment (starting with whitespace and #) from an unquoted value
+func removeComment(value string) string {
+	for i := 1; i < len(value); i++ {
+		if value[i] == '#' && (value[i-1] == ' ' || value[i-1] == '\t') {
+			value = value[:i]
+			break
+		}
+	}
+	return strings.TrimSpace(value)
+}
+
+// unescape replaces the escape sequences allowed in double quoted values
+func unescape(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+	output := &strings.Builder{}
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i == len(value)-1 {
+			output.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case 'n':
+			output.WriteByte('\n')
+		case 'r':
+			output.WriteByte('\r')
+		case 't':
+			output.WriteByte('\t')
+		case '"', '\\':
+			output.WriteByte(value[i])
+		case '$':
+			// keep the escaped dollar sign so it won't be expanded
+			output.WriteString(`\$`)
+		default:
+			output.WriteByte('\\')
+			output.WriteByte(value[i])
+		}
+	}
+	return output.String()
+}
+
+// expand replaces $VAR and ${VAR} references. Unknown variables are replaced by an empty string
+func expand(value string, resolve LookupFunc) string {
+	if !strings.Contains(value, "$") {
+		return value
+	}
+	const escapedDollar = "\x00"
+	value = strings.ReplaceAll(value, `\$`, escapedDollar)
+	value = os.Expand(value, func(key string) string {
+		resolved, _ := resolve(key)
+		return resolved
+	})
+	return strings.ReplaceAll(value, escapedDollar, "$")
+}
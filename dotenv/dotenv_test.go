@@ -0,0 +1,130 @@
+package dotenv
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	testData := []struct {
+		input    string
+		expected map[string]string
+	}{
+		{"", map[string]string{}},
+		{"# comment only\n\n", map[string]string{}},
+		{"KEY=value", map[string]string{"KEY": "value"}},
+		{"KEY = value ", map[string]string{"KEY": "value"}},
+		{"export KEY=value", map[string]string{"KEY": "value"}},
+		{"KEY=value # comment", map[string]string{"KEY": "value"}},
+		{"KEY=value#not-a-comment", map[string]string{"KEY": "value#not-a-comment"}},
+		{"KEY=", map[string]string{"KEY": ""}},
+		{`KEY="quoted value # not a comment"`, map[string]string{"KEY": "quoted value # not a comment"}},
+		{`KEY="quoted" # comment`, map[string]string{"KEY": "quoted"}},
+		{`KEY='single $QUOTED'`, map[string]string{"KEY": "single $QUOTED"}},
+		{`KEY="line1\nline2\t\"end\""`, map[string]string{"KEY": "line1\nline2\t\"end\""}},
+		{"KEY=\"multi\nline\"", map[string]string{"KEY": "multi\nline"}},
+		{"FIRST=one\nSECOND=${FIRST}-two\nTHIRD=\"$SECOND-three\"", map[string]string{"FIRST": "one", "SECOND": "one-two", "THIRD": "one-two-three"}},
+		{"KEY=${UNKNOWN}", map[string]string{"KEY": ""}},
+		{"KEY=${EXTERNAL}", map[string]string{"KEY": "external"}},
+		{`KEY="\${EXTERNAL}"`, map[string]string{"KEY": "${EXTERNAL}"}},
+	}
+
+	lookup := func(key string) (string, bool) {
+		if key == "EXTERNAL" {
+			return "external", true
+		}
+		return "", false
+	}
+	for _, testItem := range testData {
+		t.Run(testItem.input, func(t *testing.T) {
+			values, err := Parse(strings.NewReader(testItem.input), lookup)
+			require.NoError(t, err)
+			assert.Equal(t, testItem.expected, values)
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	testData := []struct {
+		input string
+		err   string
+	}{
+		{"KEY", "line 1: expected KEY=VALUE"},
+		{"\n1KEY=value", "line 2: invalid variable name '1KEY'"},
+		{`KEY="not closed`, "line 1: missing closing quote \""},
+		{`KEY="value" trailing`, "line 1: unexpected characters after closing quote"},
+	}
+
+	for _, testItem := range testData {
+		t.Run(testItem.input, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(testItem.input), nil)
+			assert.EqualError(t, err, testItem.err)
+		})
+	}
+}
+
+func TestQuote(t *testing.T) {
+	testData := []struct {
+		value  string
+		quoted string
+	}{
+		{"", "''"},
+		{"simple", "'simple'"},
+		{`with $HOME and "quotes" # not a comment`, `'with $HOME and "quotes" # not a comment'`},
+		{`it's`, `"it's"`},
+		{`it's $HOME \ "quoted"`, `"it's \$HOME \\ \"quoted\""`},
+		{"it's\nmultiline", `"it's\nmultiline"`},
+	}
+
+	for _, testItem := range testData {
+		t.Run(testItem.value, func(t *testing.T) {
+			quoted := Quote(testItem.value)
+			assert.Equal(t, testItem.quoted, quoted)
+			values, err := Parse(strings.NewReader("KEY="+quoted), nil)
+			require.NoError(t, err)
+			assert.Equal(t, testItem.value, values["KEY"])
+		})
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	filename := filepath.Join(os.TempDir(), fmt.Sprintf("%s%d%d.env", "TestLoadFile", time.Now().UnixNano(), os.Getpid()))
+	defer os.Remove(filename)
+
+	err := ioutil.WriteFile(filename, []byte("AWS_SECRET_ACCESS_KEY=secret\n"), 0600)
+	require.NoError(t, err)
+
+	values, err := Load(filename)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"AWS_SECRET_ACCESS_KEY": "secret"}, values)
+}
+
+func TestLoadWorldReadableFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file permissions are not checked on Windows")
+	}
+	filename := filepath.Join(os.TempDir(), fmt.Sprintf("%s%d%d.env", "TestLoadWorldReadableFile", time.Now().UnixNano(), os.Getpid()))
+	defer os.Remove(filename)
+
+	err := ioutil.WriteFile(filename, []byte("AWS_SECRET_ACCESS_KEY=secret\n"), 0600)
+	require.NoError(t, err)
+	err = os.Chmod(filename, 0644)
+	require.NoError(t, err)
+
+	_, err = Load(filename)
+	assert.Error(t, err)
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	_, err := Load("some file that does not exist")
+	assert.Error(t, err)
+}
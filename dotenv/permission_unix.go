@@ -0,0 +1,20 @@
+//+build !windows
+
+package dotenv
+
+import (
+	"fmt"
+	"os"
+)
+
+// checkPermission returns an error if the file can be read by anyone
+func checkPermission(filename string) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	if info.Mode().Perm()&0004 != 0 {
+		return fmt.Errorf("file '%s' is readable by everyone, please restrict its permissions (chmod o-r)", filename)
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+//+build windows
+
+package dotenv
+
+import "os"
+
+// checkPermission only checks the file exists: file permissions are handled by ACLs on Windows
+func checkPermission(filename string) error {
+	_, err := os.Stat(filename)
+	return err
+}
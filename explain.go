@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/creativeprojects/clog"
+	"github.com/creativeprojects/resticprofile/config"
+	"github.com/creativeprojects/resticprofile/constants"
+	"github.com/creativeprojects/resticprofile/filesearch"
+	"github.com/creativeprojects/resticprofile/secret"
+	"github.com/spf13/pflag"
+)
+
+// planStep is one command run by resticprofile for a profile
+type planStep struct {
+	Step      string   `json:"step"`
+	Command   string   `json:"command"`
+	Args      []string `json:"args,omitempty"`
+	Env       []string `json:"env,omitempty"`
+	Timeout   string   `json:"timeout,omitempty"`
+	OnFailure bool     `json:"on-failure,omitempty"`
+	Finally   bool     `json:"finally,omitempty"`
+}
+
+// explainProfile displays all the commands that would run for a profile and a command, in order
+func explainProfile(c *config.Config, flags commandLineFlags, args []string) error {
+	format := ""
+	showSecrets := false
+	flagset := pflag.NewFlagSet("explain", pflag.ContinueOnError)
+	flagset.StringVar(&format, "format", "", "output format (json)")
+	flagset.BoolVar(&showSecrets, "show-secrets", false, "display passwords and other secrets in clear")
+	// the flags after the command are sent to restic
+	flagset.SetInterspersed(false)
+	err := flagset.Parse(args)
+	if err != nil {
+		return err
+	}
+	if format != "" && format != config.FormatJSON {
+		return fmt.Errorf("unsupported format '%s'", format)
+	}
+
+	global, err := c.GetGlobalSection()
+	if err != nil {
+		return fmt.Errorf("cannot load global configuration: %w", err)
+	}
+
+	resticCommand := global.DefaultCommand
+	resticArguments := flagset.Args()
+	if len(resticArguments) > 0 {
+		resticCommand = resticArguments[0]
+		resticArguments = resticArguments[1:]
+	}
+
+	profile, err := c.GetProfile(flags.name, resticCommand)
+	if err != nil {
+		return fmt.Errorf("cannot load profile '%s': %w", flags.name, err)
+	}
+	if profile == nil {
+		return fmt.Errorf("profile '%s' not found", flags.name)
+	}
+	if flags.quiet {
+		profile.Quiet = true
+		profile.Verbose = false
+	}
+	if flags.verbose {
+		profile.Verbose = true
+		profile.Quiet = false
+	}
+	profile.SetRootPath(c.GetBaseDir())
+	profile.SetHost(getHostname())
+
+	resticBinary, err := filesearch.FindResticBinary(global.ResticBinary)
+	if err != nil {
+		clog.Warningf("cannot find restic: %v", err)
+		resticBinary = "restic"
+	}
+
+	wrapper := newResticWrapper(
+		resticBinary,
+		global.Initialize || profile.Initialize,
+		false,
+		profile,
+		resticCommand,
+		resticArguments,
+		nil,
+	)
+	steps, err := wrapper.explainPlan(showSecrets)
+	if err != nil {
+		return err
+	}
+
+	if format == config.FormatJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(steps)
+	}
+	displayPlan(os.Stdout, flags.name, resticCommand, steps)
+	return nil
+}
+
+// explainPlan returns all the steps the profile would run, without running any.
+// References to secrets are displayed instead of their values.
+func (r *resticWrapper) explainPlan(showSecrets bool) ([]planStep, error) {
+	steps := make([]planStep, 0)
+	onFailure := false
+	finally := false
+	r.explain = func(step string, command shellCommandDefinition) {
+		planned := planStep{
+			Step:      step,
+			Command:   command.command,
+			Args:      command.args,
+			Env:       planEnvironment(command.env, showSecrets),
+			OnFailure: onFailure,
+			Finally:   finally,
+		}
+		if command.timeout > 0 {
+			planned.Timeout = command.timeout.String()
+		}
+		steps = append(steps, planned)
+	}
+	// explaining the plan should not leave any trace in the status file
+	r.profile.StatusFile = ""
+
+	err := r.loadEnvironmentFiles()
+	if err != nil {
+		return nil, err
+	}
+	r.secrets = make(map[string]string)
+	if r.profile.Password != "" && !secret.IsCommand(r.profile.Password) {
+		r.secrets[constants.EnvResticPassword] = r.profile.Password
+	}
+
+	err = r.runSteps()
+	if err != nil {
+		return nil, err
+	}
+	onFailure = true
+	err = r.runPostFailCommand(r.command, errors.New("<error message>"))
+	if err != nil {
+		return nil, err
+	}
+	err = r.runProfilePostFailCommand(errors.New("<error message>"))
+	if err != nil {
+		return nil, err
+	}
+	onFailure = false
+	finally = true
+	err = r.runFinallyCommand(r.command, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = r.runProfileFinallyCommand(nil)
+	if err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
+
+// planEnvironment returns the variables added to the environment of the current process, in alphabetical order
+func planEnvironment(env []string, showSecrets bool) []string {
+	output := make([]string, len(env))
+	for i, keyValue := range env {
+		if !showSecrets {
+			keyValueSplit := strings.SplitN(keyValue, "=", 2)
+			if len(keyValueSplit) == 2 && secret.IsSensitiveKey(keyValueSplit[0]) {
+				keyValue = keyValueSplit[0] + "=" + secret.Mask(keyValueSplit[1])
+			}
+		}
+		output[i] = keyValue
+	}
+	sort.Strings(output)
+	return output
+}
+
+func displayPlan(w io.Writer, profileName, command string, steps []planStep) {
+	fmt.Fprintf(w, "\nprofile '%s', command '%s':\n\n", profileName, command)
+	number := 0
+	number = displayPlanSteps(w, number, "", steps, func(step planStep) bool {
+		return !step.OnFailure && !step.Finally
+	})
+	number = displayPlanSteps(w, number, "on failure:", steps, func(step planStep) bool {
+		return step.OnFailure
+	})
+	displayPlanSteps(w, number, "finally:", steps, func(step planStep) bool {
+		return step.Finally
+	})
+}
+
+// displayPlanSteps displays the steps selected by the filter under the title, and returns the number of the last step displayed
+func displayPlanSteps(w io.Writer, number int, title string, steps []planStep, filter func(planStep) bool) int {
+	for _, step := range steps {
+		if !filter(step) {
+			continue
+		}
+		if title != "" {
+			fmt.Fprintf(w, "%s\n\n", title)
+			title = ""
+		}
+		number++
+		displayPlanStep(w, number, step)
+	}
+	return number
+}
+
+func displayPlanStep(w io.Writer, number int, step planStep) {
+	fmt.Fprintf(w, "%3d. %s\n", number, step.Step)
+	fmt.Fprintf(w, "     %s\n", strings.TrimSpace(step.Command+" "+strings.Join(step.Args, " ")))
+	for _, env := range step.Env {
+		fmt.Fprintf(w, "       %s\n", env)
+	}
+	if step.Timeout != "" {
+		fmt.Fprintf(w, "     timeout: %s\n", step.Timeout)
+	}
+	fmt.Fprintln(w, "")
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creativeprojects/resticprofile/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplainBackupPlan(t *testing.T) {
+	profile := config.NewProfile(nil, "name")
+	profile.Repository = "/backup"
+	profile.Password = "env:BACKUP_PASSWORD"
+	profile.StatusFile = "status.json"
+	profile.RunBefore = []string{"echo profile before"}
+	profile.RunAfter = []string{"echo profile after"}
+	profile.RunAfterFail = []string{"echo failed"}
+	profile.Timeout = time.Hour
+	profile.RunBeforeTimeout = time.Minute
+	profile.Environment = map[string]string{
+		"aws_secret_access_key": "secret",
+		"user":                  "me",
+	}
+	profile.Backup = &config.BackupSection{
+		CheckBefore: true,
+		RunBefore:   []string{"echo backup before"},
+		RunAfter:    []string{"echo backup after"},
+		Source:      []string{"/source"},
+		Timeout:     2 * time.Hour,
+	}
+	profile.Retention = &config.RetentionSection{
+		BeforeBackup: true,
+	}
+
+	wrapper := newResticWrapper("restic", true, false, profile, "backup", []string{"--tag", "test"}, nil)
+	steps, err := wrapper.explainPlan(false)
+	require.NoError(t, err)
+
+	names := make([]string, len(steps))
+	for i, step := range steps {
+		names[i] = step.Step
+	}
+	assert.Equal(t, []string{"run-before", "init", "backup run-before", "check", "retention", "backup", "backup run-after", "run-after", "run-after-fail"}, names)
+	assert.Equal(t, "echo profile before", steps[0].Command)
+	assert.Equal(t, []string{
+		"AWS_SECRET_ACCESS_KEY=***",
+		"HOOK_STAGE=run-before",
+		"PROFILE_COMMAND=backup",
+		"PROFILE_CONFIG=",
+		"PROFILE_DRY_RUN=false",
+		"PROFILE_NAME=name",
+		"PROFILE_REPOSITORY=/backup",
+		"RESTIC_PASSWORD=env:BACKUP_PASSWORD",
+		"USER=me",
+	}, steps[0].Env)
+	assert.Equal(t, "restic", steps[5].Command)
+	assert.Equal(t, []string{"backup", "--repo", "/backup", "--tag", "test", "/source"}, steps[5].Args)
+	assert.Equal(t, []string{"AWS_SECRET_ACCESS_KEY=***", "RESTIC_PASSWORD=env:BACKUP_PASSWORD", "USER=me"}, steps[5].Env)
+	assert.Equal(t, "1m0s", steps[0].Timeout)
+	assert.Equal(t, "1h0m0s", steps[3].Timeout)
+	assert.Equal(t, "2h0m0s", steps[5].Timeout)
+	assert.Equal(t, "", steps[6].Timeout)
+	assert.False(t, steps[7].OnFailure)
+	assert.True(t, steps[8].OnFailure)
+	assert.Contains(t, steps[8].Env, "ERROR=<error message>")
+	// no status should be written
+	assert.NoFileExists(t, "status.json")
+}
+
+func TestExplainCheckPlan(t *testing.T) {
+	profile := config.NewProfile(nil, "name")
+	profile.RunAfterFail = []string{"echo profile failed"}
+	profile.RunFinally = []string{"echo profile finally"}
+	profile.Check = &config.OtherSectionWithSchedule{
+		RunBefore:    []string{"mount /mnt/backup"},
+		RunAfter:     []string{"umount /mnt/backup"},
+		RunAfterFail: []string{"umount /mnt/backup"},
+		RunFinally:   []string{"echo check finally"},
+	}
+
+	wrapper := newResticWrapper("restic", false, false, profile, "check", nil, nil)
+	steps, err := wrapper.explainPlan(false)
+	require.NoError(t, err)
+
+	names := make([]string, len(steps))
+	for i, step := range steps {
+		names[i] = step.Step
+	}
+	assert.Equal(t, []string{"check run-before", "check", "check run-after", "check run-after-fail", "run-after-fail", "check run-finally", "run-finally"}, names)
+	assert.Equal(t, "mount /mnt/backup", steps[0].Command)
+	assert.True(t, steps[3].OnFailure)
+	assert.Contains(t, steps[3].Env, "ERROR=<error message>")
+	assert.True(t, steps[5].Finally)
+	assert.False(t, steps[5].OnFailure)
+	assert.NotContains(t, strings.Join(steps[5].Env, " "), "ERROR=")
+}
+
+func TestExplainShowSecrets(t *testing.T) {
+	profile := config.NewProfile(nil, "name")
+	profile.Environment = map[string]string{
+		"aws_secret_access_key": "secret",
+	}
+	wrapper := newResticWrapper("restic", false, false, profile, "snapshots", nil, nil)
+	steps, err := wrapper.explainPlan(true)
+	require.NoError(t, err)
+	require.Len(t, steps, 1)
+	assert.Equal(t, []string{"AWS_SECRET_ACCESS_KEY=secret"}, steps[0].Env)
+}
+
+func TestDisplayPlan(t *testing.T) {
+	steps := []planStep{
+		{Step: "run-before", Command: "echo before", Env: []string{"PROFILE_NAME=name"}},
+		{Step: "snapshots", Command: "restic", Args: []string{"snapshots", "--repo", "/backup"}},
+		{Step: "run-after-fail", Command: "echo failed", OnFailure: true},
+	}
+	buffer := &bytes.Buffer{}
+	displayPlan(buffer, "name", "snapshots", steps)
+	assert.Equal(t, `
+profile 'name', command 'snapshots':
+
+  1. run-before
+     echo before
+       PROFILE_NAME=name
+
+  2. snapshots
+     restic snapshots --repo /backup
+
+on failure:
+
+  3. run-after-fail
+     echo failed
+
+`, buffer.String())
+}
+
+func TestDisplayPlanWithFinally(t *testing.T) {
+	steps := []planStep{
+		{Step: "backup", Command: "restic", Args: []string{"backup"}},
+		{Step: "run-after-fail", Command: "echo failed", OnFailure: true},
+		{Step: "run-finally", Command: "echo finally", Finally: true},
+	}
+	buffer := &bytes.Buffer{}
+	displayPlan(buffer, "name", "backup", steps)
+	assert.Equal(t, `
+profile 'name', command 'backup':
+
+  1. backup
+     restic backup
+
+on failure:
+
+  2. run-after-fail
+     echo failed
+
+finally:
+
+  3. run-finally
+     echo finally
+
+`, buffer.String())
+}
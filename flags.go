@@ -26,6 +26,12 @@ type commandLineFlags struct {
 	wait        bool
 	isChild     bool
 	parentPort  int
+	set         []string
+	baseDir     string
+	configCache string
+	tlsCert     string
+	tlsKey      string
+	tlsCA       string
 }
 
 // loadFlags loads command line flags (before any command)
@@ -48,11 +54,17 @@ func loadFlags() (*pflag.FlagSet, commandLineFlags) {
 	flagset.BoolVarP(&flags.quiet, "quiet", "q", constants.DefaultQuietFlag, "display only warnings and errors")
 	flagset.BoolVarP(&flags.verbose, "verbose", "v", constants.DefaultVerboseFlag, "display some debugging information")
 	flagset.BoolVar(&flags.veryVerbose, "trace", constants.DefaultVerboseFlag, "display even more debugging information")
-	flagset.StringVarP(&flags.config, "config", "c", constants.DefaultConfigurationFile, "configuration file")
+	flagset.StringVarP(&flags.config, "config", "c", constants.DefaultConfigurationFile, "configuration file, URL, or \"-\" to read from stdin")
 	flagset.StringVarP(&flags.format, "format", "f", "", "file format of the configuration (default is to use the file extension)")
+	flagset.StringVar(&flags.baseDir, "base-dir", "", "directory of the relative paths in the configuration (default is the directory of the configuration file)")
+	flagset.StringVar(&flags.configCache, "config-cache", "", "directory keeping a copy of the configuration downloaded from a URL (only downloaded again when modified)")
+	flagset.StringVar(&flags.tlsCert, "tls-cert", "", "client certificate file (PEM) to download the configuration")
+	flagset.StringVar(&flags.tlsKey, "tls-key", "", "private key file (PEM) of the client certificate")
+	flagset.StringVar(&flags.tlsCA, "tls-ca", "", "certificate authority file (PEM) to verify the server of the configuration")
 	flagset.StringVarP(&flags.name, "name", "n", constants.DefaultProfileName, "profile name")
 	flagset.StringVarP(&flags.logFile, "log", "l", "", "logs into a file instead of the console")
 	flagset.BoolVar(&flags.dryRun, "dry-run", false, "display the restic commands instead of running them")
+	flagset.StringArrayVar(&flags.set, "set", nil, "set a value of the profile (or of the global section with a global. prefix) on top of the configuration file: key=value (can be repeated)")
 
 	flagset.BoolVar(&flags.noAnsi, "no-ansi", false, "disable ansi control characters (disable console colouring)")
 	flagset.StringVar(&flags.theme, "theme", constants.DefaultTheme, "console colouring theme (dark, light, none)")
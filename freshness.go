@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/creativeprojects/clog"
+	"github.com/creativeprojects/resticprofile/config"
+	"github.com/creativeprojects/resticprofile/constants"
+	"github.com/creativeprojects/resticprofile/filesearch"
+	"github.com/creativeprojects/resticprofile/status"
+	"github.com/spf13/pflag"
+)
+
+// freshness is the age of the last successful run of a profile command, compared to its max-age
+type freshness struct {
+	profileName string
+	command     string
+	maxAge      time.Duration
+	lastSuccess time.Time
+}
+
+// age returns the time elapsed since the last successful run
+func (f freshness) age(now time.Time) time.Duration {
+	return now.Sub(f.lastSuccess)
+}
+
+// stale returns true when the command never succeeded, or when its last successful run is older than the max-age
+func (f freshness) stale(now time.Time) bool {
+	return f.lastSuccess.IsZero() || f.age(now) > f.maxAge
+}
+
+// staleError returns the reason why the command is stale
+func (f freshness) staleError(now time.Time) error {
+	if f.lastSuccess.IsZero() {
+		return fmt.Errorf("no successful %s recorded for profile '%s'", f.command, f.profileName)
+	}
+	return fmt.Errorf("last successful %s of profile '%s' was %s ago (max-age is %s)",
+		f.command, f.profileName, f.age(now).Round(time.Second), f.maxAge)
+}
+
+// checkFreshness verifies the last successful run of each command with a max-age is recent enough
+func checkFreshness(c *config.Config, flags commandLineFlags, args []string) error {
+	useRestic := false
+	allProfiles := false
+	notify := false
+	flagset := pflag.NewFlagSet("check-freshness", pflag.ContinueOnError)
+	flagset.BoolVar(&useRestic, "restic", false, "also ask restic for the time of the latest snapshot (for the backup command)")
+	flagset.BoolVar(&allProfiles, "all-profiles", false, "check all the profiles with a max-age")
+	flagset.BoolVar(&notify, "notify", false, "run the 'run-after-fail' commands of the profile for each stale command")
+	err := flagset.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	resticBinary := ""
+	if useRestic || notify {
+		global, err := c.GetGlobalSection()
+		if err != nil {
+			return fmt.Errorf("cannot load global configuration: %w", err)
+		}
+		resticBinary, err = filesearch.FindResticBinary(global.ResticBinary)
+		if err != nil {
+			return fmt.Errorf("cannot find restic: %w", err)
+		}
+	}
+
+	profileNames := []string{flags.name}
+	if allProfiles {
+		profileNames = make([]string, 0)
+		for profileName := range c.GetProfileSections() {
+			profileNames = append(profileNames, profileName)
+		}
+		sort.Strings(profileNames)
+	}
+
+	now := time.Now()
+	results := make([]freshness, 0)
+	profiles := make(map[string]*config.Profile, len(profileNames))
+	for _, profileName := range profileNames {
+		profile, err := loadProfile(c, flags, profileName, constants.CommandSnapshots)
+		if err != nil {
+			return err
+		}
+		profiles[profileName] = profile
+		profileResults := getFreshness(profile, func() (time.Time, error) {
+			if !useRestic {
+				return time.Time{}, nil
+			}
+			return newResticWrapper(resticBinary, false, false, profile, constants.CommandSnapshots, nil, nil).latestSnapshotTime()
+		})
+		if len(profileResults) == 0 && !allProfiles {
+			return fmt.Errorf("no max-age defined in profile '%s'", profileName)
+		}
+		results = append(results, profileResults...)
+	}
+
+	displayFreshness(os.Stdout, results, now)
+
+	stale := 0
+	for _, result := range results {
+		if !result.stale(now) {
+			continue
+		}
+		stale++
+		if notify {
+			wrapper := newResticWrapper(resticBinary, false, flags.dryRun, profiles[result.profileName], result.command, nil, nil)
+			err = wrapper.notifyFailure(result.staleError(now))
+			if err != nil {
+				clog.Warningf("cannot notify profile '%s': %v", result.profileName, err)
+			}
+		}
+	}
+	if stale > 0 {
+		return fmt.Errorf("%d command(s) didn't run successfully within their max-age", stale)
+	}
+	return nil
+}
+
+// getFreshness returns the time of the last successful run of each command with a max-age, from the status file.
+// The latest snapshot is used for the backup command when more recent
+func getFreshness(profile *config.Profile, latestSnapshot func() (time.Time, error)) []freshness {
+	maxAges := profile.MaxAges()
+	commands := make([]string, 0, len(maxAges))
+	for command := range maxAges {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+
+	var profileStatus *status.Profile
+	if profile.StatusFile != "" {
+		profileStatus = status.NewStatus(profile.StatusFile).Load().Profile(profile.Name)
+	}
+
+	results := make([]freshness, 0, len(commands))
+	for _, command := range commands {
+		result := freshness{
+			profileName: profile.Name,
+			command:     command,
+			maxAge:      maxAges[command],
+		}
+		if profileStatus != nil {
+			if commandStatus := profileStatus.Command(command); commandStatus != nil {
+				result.lastSuccess = commandStatus.GetLastSuccess()
+			}
+		}
+		if command == constants.CommandBackup {
+			snapshotTime, err := latestSnapshot()
+			if err != nil {
+				clog.Warningf("cannot load the latest snapshot of profile '%s': %v", profile.Name, err)
+			} else if snapshotTime.After(result.lastSuccess) {
+				result.lastSuccess = snapshotTime
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func displayFreshness(w io.Writer, results []freshness, now time.Time) {
+	writer := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(writer, "\nProfile\tCommand\tMax age\tLast success\tAge\tStatus\t")
+	for _, result := range results {
+		lastSuccess, age, state := "never", "", "STALE"
+		if !result.lastSuccess.IsZero() {
+			lastSuccess = result.lastSuccess.Local().Format("2006-01-02 15:04:05")
+			age = result.age(now).Round(time.Second).String()
+			if !result.stale(now) {
+				state = "ok"
+			}
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t\n", result.profileName, result.command, result.maxAge, lastSuccess, age, state)
+	}
+	writer.Flush()
+	fmt.Fprintln(w, "")
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/creativeprojects/resticprofile/config"
+	"github.com/creativeprojects/resticprofile/constants"
+	"github.com/creativeprojects/resticprofile/status"
+	"github.com/creativeprojects/resticprofile/term"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFreshness(t *testing.T) {
+	now := time.Date(2020, 10, 30, 18, 0, 0, 0, time.UTC)
+	result := freshness{profileName: "root", command: "backup", maxAge: 26 * time.Hour}
+	assert.True(t, result.stale(now))
+	assert.EqualError(t, result.staleError(now), "no successful backup recorded for profile 'root'")
+
+	result.lastSuccess = now.Add(-25 * time.Hour)
+	assert.False(t, result.stale(now))
+
+	result.lastSuccess = now.Add(-27 * time.Hour)
+	assert.True(t, result.stale(now))
+	assert.EqualError(t, result.staleError(now), "last successful backup of profile 'root' was 27h0m0s ago (max-age is 26h0m0s)")
+}
+
+func TestGetFreshness(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resticprofile-freshness")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	statusFile := filepath.Join(dir, "status.json")
+	profileStatus := status.NewStatus(statusFile)
+	profileStatus.Profile("root").BackupSuccess()
+	profileStatus.Profile("root").CheckError(errors.New("repository damaged"))
+	require.NoError(t, profileStatus.Save())
+	backupTime := profileStatus.Profile("root").Command("backup").Time
+
+	c, err := config.Load(bytes.NewBufferString(fmt.Sprintf(`
+[root]
+status-file = %q
+
+[root.backup]
+max-age = "26h"
+
+[root.check]
+max-age = "720h"
+
+[root.retention]
+max-age = "48h"
+`, statusFile)), "toml")
+	require.NoError(t, err)
+	profile, err := c.GetProfile("root", "")
+	require.NoError(t, err)
+
+	noSnapshot := func() (time.Time, error) { return time.Time{}, nil }
+	results := getFreshness(profile, noSnapshot)
+	require.Len(t, results, 3)
+	assert.Equal(t, "backup", results[0].command)
+	assert.Equal(t, 26*time.Hour, results[0].maxAge)
+	assert.True(t, backupTime.Equal(results[0].lastSuccess))
+	assert.Equal(t, "check", results[1].command)
+	assert.True(t, results[1].lastSuccess.IsZero())
+	assert.Equal(t, "retention", results[2].command)
+	assert.True(t, results[2].lastSuccess.IsZero())
+
+	// the latest snapshot is more recent than the status
+	snapshotTime := backupTime.Add(time.Hour)
+	results = getFreshness(profile, func() (time.Time, error) { return snapshotTime, nil })
+	assert.True(t, snapshotTime.Equal(results[0].lastSuccess))
+
+	// an older snapshot doesn't change the result
+	results = getFreshness(profile, func() (time.Time, error) { return backupTime.Add(-time.Hour), nil })
+	assert.True(t, backupTime.Equal(results[0].lastSuccess))
+
+	// restic is not available
+	results = getFreshness(profile, func() (time.Time, error) { return time.Time{}, errors.New("no restic") })
+	assert.True(t, backupTime.Equal(results[0].lastSuccess))
+}
+
+func TestDisplayFreshness(t *testing.T) {
+	now := time.Date(2020, 10, 30, 18, 0, 0, 0, time.Local)
+	results := []freshness{
+		{profileName: "root", command: "backup", maxAge: 26 * time.Hour, lastSuccess: now.Add(-2 * time.Hour)},
+		{profileName: "root", command: "check", maxAge: 720 * time.Hour},
+	}
+	buffer := &bytes.Buffer{}
+	displayFreshness(buffer, results, now)
+	output := buffer.String()
+	assert.Contains(t, output, "root     backup   26h0m0s   2020-10-30 16:00:00  2h0m0s  ok")
+	assert.Contains(t, output, "root     check    720h0m0s  never                        STALE")
+}
+
+func TestLatestSnapshotTime(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script not available on windows")
+	}
+	dir, err := ioutil.TempDir("", "resticprofile-freshness")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	resticBinary := filepath.Join(dir, "restic")
+	err = ioutil.WriteFile(resticBinary, []byte(`#!/bin/sh
+echo '[{"time":"2020-10-29T18:00:00Z","hostname":"a"},{"time":"2020-10-30T18:00:00Z","hostname":"b"}]'
+`), 0755)
+	require.NoError(t, err)
+
+	profile := config.NewProfile(nil, "root")
+	wrapper := newResticWrapper(resticBinary, false, false, profile, "snapshots", nil, nil)
+	latest, err := wrapper.latestSnapshotTime()
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2020, 10, 30, 18, 0, 0, 0, time.UTC), latest.UTC())
+
+	wrapper = newResticWrapper("echo", false, false, profile, "snapshots", nil, nil)
+	_, err = wrapper.latestSnapshotTime()
+	assert.Error(t, err)
+}
+
+func TestScheduledRetentionFreshness(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resticprofile-freshness")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	statusFile := filepath.Join(dir, "status.json")
+	c, err := config.Load(bytes.NewBufferString(fmt.Sprintf(`
+[root]
+status-file = %q
+
+[root.retention]
+max-age = "48h"
+`, statusFile)), "toml")
+	require.NoError(t, err)
+	profile, err := c.GetProfile("root", "")
+	require.NoError(t, err)
+
+	// run the retention the same way as the scheduler does
+	term.SetOutput(&bytes.Buffer{})
+	wrapper := newResticWrapper("echo", false, false, profile, getResticCommand(constants.SectionConfigurationRetention), nil, nil)
+	require.NoError(t, wrapper.runProfile())
+
+	noSnapshot := func() (time.Time, error) { return time.Time{}, nil }
+	results := getFreshness(profile, noSnapshot)
+	require.Len(t, results, 1)
+	assert.Equal(t, "retention", results[0].command)
+	assert.False(t, results[0].stale(time.Now()))
+
+	check := nagiosCheck{profileName: "root", command: "retention"}
+	require.NoError(t, check.load(c, commandLineFlags{}, false))
+	state, _ := check.evaluate(time.Now())
+	assert.Equal(t, nagiosOK, state)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/creativeprojects/resticprofile/config"
+	"github.com/creativeprojects/resticprofile/history"
+	"github.com/spf13/pflag"
+)
+
+// historyDateFormats are the formats accepted by the --since and --until flags
+var historyDateFormats = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// showHistory displays the runs recorded in the history file of the profile, with statistics for each command
+func showHistory(c *config.Config, flags commandLineFlags, args []string) error {
+	command := ""
+	since := ""
+	until := ""
+	allProfiles := false
+	format := ""
+	flagset := pflag.NewFlagSet("history", pflag.ContinueOnError)
+	flagset.StringVar(&command, "command", "", "only display the runs of this command")
+	flagset.StringVar(&since, "since", "", "only display the runs started from this date (like 2020-10-30 or 2020-10-30 18:00)")
+	flagset.StringVar(&until, "until", "", "only display the runs started before this date")
+	flagset.BoolVar(&allProfiles, "all-profiles", false, "display the runs of all the profiles sharing the same history file")
+	flagset.StringVar(&format, "format", "", "output format (json)")
+	err := flagset.Parse(args)
+	if err != nil {
+		return err
+	}
+	if format != "" && format != "json" {
+		return fmt.Errorf("unsupported history format '%s'", format)
+	}
+
+	filter := history.Filter{
+		Command: command,
+	}
+	if !allProfiles {
+		filter.Profile = flags.name
+	}
+	filter.Since, err = parseHistoryDate(since)
+	if err != nil {
+		return err
+	}
+	filter.Until, err = parseHistoryDate(until)
+	if err != nil {
+		return err
+	}
+
+	profile, err := c.GetProfile(flags.name, "history")
+	if err != nil {
+		return fmt.Errorf("cannot load profile '%s': %w", flags.name, err)
+	}
+	if profile == nil {
+		return fmt.Errorf("profile '%s' not found", flags.name)
+	}
+	if profile.HistoryFile == "" {
+		return fmt.Errorf("no history file defined in profile '%s'", flags.name)
+	}
+
+	entries, err := history.NewHistory(profile.HistoryFile).Load(filter)
+	if err != nil {
+		return fmt.Errorf("cannot load history file '%s': %w", profile.HistoryFile, err)
+	}
+	if format == "json" {
+		return displayHistoryJSON(os.Stdout, entries)
+	}
+	displayHistory(os.Stdout, entries)
+	return nil
+}
+
+// parseHistoryDate returns the date from one of the historyDateFormats (in local time), or a zero time if the value is empty
+func parseHistoryDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, format := range historyDateFormats {
+		date, err := time.ParseInLocation(format, value, time.Local)
+		if err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date '%s': expected format is YYYY-MM-DD or YYYY-MM-DD HH:MM", value)
+}
+
+func displayHistory(w io.Writer, entries []history.Entry) {
+	if len(entries) == 0 {
+		fmt.Fprintln(w, "\nno run found in history")
+		fmt.Fprintln(w, "")
+		return
+	}
+	writer := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(writer, "\nStarted\tProfile\tCommand\tDuration\tResult\t")
+	for _, entry := range entries {
+		result := "success"
+		if !entry.Success {
+			result = "failed (" + strconv.Itoa(entry.ExitCode) + "): " + entry.Error
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t\n",
+			entry.Start.Local().Format("2006-01-02 15:04:05"),
+			entry.Profile,
+			entry.Command,
+			formatSeconds(entry.Duration),
+			result,
+		)
+	}
+	writer.Flush()
+
+	writer = tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(writer, "\nProfile\tCommand\tRuns\tSuccess rate\tAverage duration\tLast run\t")
+	for _, stats := range history.ComputeStats(entries) {
+		fmt.Fprintf(writer, "%s\t%s\t%d\t%.1f%%\t%s\t%s\t\n",
+			stats.Profile,
+			stats.Command,
+			stats.Runs,
+			stats.SuccessRate(),
+			formatSeconds(stats.AverageDuration()),
+			stats.LastRun.Local().Format("2006-01-02 15:04:05"),
+		)
+	}
+	writer.Flush()
+	fmt.Fprintln(w, "")
+}
+
+// historyStats is the JSON representation of the statistics of a command
+type historyStats struct {
+	Profile         string    `json:"profile"`
+	Command         string    `json:"command"`
+	Runs            int       `json:"runs"`
+	Successes       int       `json:"successes"`
+	SuccessRate     float64   `json:"success-rate"`
+	AverageDuration float64   `json:"average-duration"`
+	LastRun         time.Time `json:"last-run"`
+}
+
+func displayHistoryJSON(w io.Writer, entries []history.Entry) error {
+	allStats := history.ComputeStats(entries)
+	output := struct {
+		Runs  []history.Entry `json:"runs"`
+		Stats []historyStats  `json:"stats"`
+	}{
+		Runs:  entries,
+		Stats: make([]historyStats, len(allStats)),
+	}
+	for i, stats := range allStats {
+		output.Stats[i] = historyStats{
+			Profile:         stats.Profile,
+			Command:         stats.Command,
+			Runs:            stats.Runs,
+			Successes:       stats.Successes,
+			SuccessRate:     stats.SuccessRate(),
+			AverageDuration: stats.AverageDuration(),
+			LastRun:         stats.LastRun,
+		}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(output)
+}
+
+// formatSeconds displays a duration in seconds, rounded to the second
+func formatSeconds(seconds float64) string {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Second).String()
+}
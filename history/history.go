@@ -0,0 +1,282 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/creativeprojects/resticprofile/lock"
+	"github.com/spf13/afero"
+)
+
+const (
+	// lockTimeout is the maximum time to wait for another process to finish writing the history file
+	lockTimeout = 30 * time.Second
+	// lockRetryDelay is the time to wait before trying to acquire the lock again
+	lockRetryDelay = 50 * time.Millisecond
+)
+
+// Entry is the record of one run of a profile command
+type Entry struct {
+	Profile  string            `json:"profile"`
+	Command  string            `json:"command"`
+	Start    time.Time         `json:"start"`
+	End      time.Time         `json:"end"`
+	Duration float64           `json:"duration"`
+	Success  bool              `json:"success"`
+	ExitCode int               `json:"exit-code"`
+	Error    string            `json:"error,omitempty"`
+	Host     string            `json:"host,omitempty"`
+	Summary  map[string]string `json:"summary,omitempty"`
+}
+
+// NewEntry creates a new entry of a run which started and ended at these times.
+// The duration is in seconds
+func NewEntry(profileName, command string, start, end time.Time) Entry {
+	return Entry{
+		Profile:  profileName,
+		Command:  command,
+		Start:    start,
+		End:      end,
+		Duration: end.Sub(start).Seconds(),
+		Success:  true,
+	}
+}
+
+// Filter selects the entries of the history. Empty fields match any entry
+type Filter struct {
+	Profile string
+	Command string
+	Since   time.Time
+	Until   time.Time
+}
+
+// Match returns true when the entry is selected by the filter
+func (f Filter) Match(entry Entry) bool {
+	if f.Profile != "" && f.Profile != entry.Profile {
+		return false
+	}
+	if f.Command != "" && f.Command != entry.Command {
+		return false
+	}
+	if !f.Since.IsZero() && entry.Start.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !entry.Start.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+// History is an append-only log of all the runs, one JSON entry per line
+type History struct {
+	fs       afero.Fs
+	filename string
+	// lock returns a function releasing the lock on the history file
+	lock func(filename string) (func(), error)
+}
+
+// NewHistory returns the history stored in the file
+func NewHistory(filename string) *History {
+	return &History{
+		fs:       afero.NewOsFs(),
+		filename: filename,
+		lock:     lockFile,
+	}
+}
+
+// newAferoHistory returns the history stored in the file, for unit test
+func newAferoHistory(fs afero.Fs, filename string) *History {
+	return &History{
+		fs:       fs,
+		filename: filename,
+		lock:     func(string) (func(), error) { return func() {}, nil },
+	}
+}
+
+// Append adds the entry at the end of the history.
+// The history file is locked during the write, so the entry cannot be lost by a concurrent Clean
+func (h *History) Append(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	release, err := h.lock(h.filename)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	file, err := h.fs.OpenFile(h.filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// Load returns the entries selected by the filter, in the order they were added.
+// A missing history file is the same as an empty history, and the invalid lines are ignored
+func (h *History) Load(filter Filter) ([]Entry, error) {
+	entries := make([]Entry, 0)
+	file, err := h.fs.Open(h.filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return entries, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		entry := Entry{}
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			continue
+		}
+		if filter.Match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// Clean removes the entries which started before the time in parameter. It returns the number of entries removed.
+// The history file is locked from loading the entries until the new file replaces it
+func (h *History) Clean(before time.Time) (int, error) {
+	release, err := h.lock(h.filename)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	entries, err := h.Load(Filter{})
+	if err != nil {
+		return 0, err
+	}
+	keep := make([]Entry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Start.Before(before) {
+			continue
+		}
+		keep = append(keep, entry)
+	}
+	removed := len(entries) - len(keep)
+	if removed == 0 {
+		return 0, nil
+	}
+
+	// write a new file first, so the history is never left half written
+	tempFile := h.filename + ".tmp"
+	file, err := h.fs.OpenFile(tempFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, err
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, entry := range keep {
+		err = encoder.Encode(entry)
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = h.fs.Remove(tempFile)
+		return 0, err
+	}
+	err = h.fs.Rename(tempFile, h.filename)
+	if err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// lockFile acquires the lock on the history file, waiting until lockTimeout if another process is holding it
+func lockFile(filename string) (func(), error) {
+	historyLock := lock.NewLock(filename + ".lock")
+	deadline := time.Now().Add(lockTimeout)
+	// a stale lock is only removed on the first attempt (see status.Update)
+	acquired := historyLock.ForceAcquire()
+	for !acquired {
+		if time.Now().After(deadline) {
+			who, _ := historyLock.Who()
+			return nil, fmt.Errorf("timeout waiting for the lock on history file '%s' held by %s", filename, who)
+		}
+		time.Sleep(lockRetryDelay)
+		acquired = historyLock.TryAcquire()
+	}
+	// the PID allows to detect a stale lock if this process dies before releasing it
+	historyLock.SetPID(os.Getpid())
+	return historyLock.Release, nil
+}
+
+// Stats are the statistics of the runs of a profile command
+type Stats struct {
+	Profile       string
+	Command       string
+	Runs          int
+	Successes     int
+	TotalDuration float64
+	LastRun       time.Time
+}
+
+// SuccessRate returns the percentage of successful runs
+func (s Stats) SuccessRate() float64 {
+	if s.Runs == 0 {
+		return 0
+	}
+	return float64(s.Successes) * 100 / float64(s.Runs)
+}
+
+// AverageDuration returns the average duration of a run, in seconds
+func (s Stats) AverageDuration() float64 {
+	if s.Runs == 0 {
+		return 0
+	}
+	return s.TotalDuration / float64(s.Runs)
+}
+
+// ComputeStats returns the statistics of each profile command, sorted by profile and command
+func ComputeStats(entries []Entry) []Stats {
+	index := make(map[string]*Stats)
+	for _, entry := range entries {
+		key := entry.Profile + "/" + entry.Command
+		stats, found := index[key]
+		if !found {
+			stats = &Stats{Profile: entry.Profile, Command: entry.Command}
+			index[key] = stats
+		}
+		stats.Runs++
+		if entry.Success {
+			stats.Successes++
+		}
+		stats.TotalDuration += entry.Duration
+		if entry.Start.After(stats.LastRun) {
+			stats.LastRun = entry.Start
+		}
+	}
+	allStats := make([]Stats, 0, len(index))
+	for _, stats := range index {
+		allStats = append(allStats, *stats)
+	}
+	sort.Slice(allStats, func(i, j int) bool {
+		if allStats[i].Profile == allStats[j].Profile {
+			return allStats[i].Command < allStats[j].Command
+		}
+		return allStats[i].Profile < allStats[j].Profile
+	})
+	return allStats
+}
@@ -0,0 +1,142 @@
+package history
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testEntry(profileName, command string, start time.Time, err error) Entry {
+	entry := NewEntry(profileName, command, start, start.Add(90*time.Second))
+	if err != nil {
+		entry.Success = false
+		entry.ExitCode = 1
+		entry.Error = err.Error()
+	}
+	return entry
+}
+
+func TestLoadNoHistory(t *testing.T) {
+	history := newAferoHistory(afero.NewMemMapFs(), "history.log")
+	entries, err := history.Load(Filter{})
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestAppendAndLoad(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	history := newAferoHistory(fs, "history.log")
+	start := time.Date(2020, 10, 10, 12, 0, 0, 0, time.UTC)
+
+	require.NoError(t, history.Append(testEntry("root", "backup", start, nil)))
+	require.NoError(t, history.Append(testEntry("root", "check", start.Add(time.Hour), errors.New("repository damaged"))))
+	require.NoError(t, history.Append(testEntry("src", "backup", start.Add(24*time.Hour), nil)))
+	// an invalid line is ignored
+	file, err := fs.OpenFile("history.log", 1025, 0644)
+	require.NoError(t, err)
+	_, _ = file.WriteString("not json\n")
+	file.Close()
+
+	entries, err := history.Load(Filter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "root", entries[0].Profile)
+	assert.Equal(t, 90.0, entries[0].Duration)
+	assert.False(t, entries[1].Success)
+	assert.Equal(t, "repository damaged", entries[1].Error)
+
+	entries, err = history.Load(Filter{Profile: "root"})
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	entries, err = history.Load(Filter{Command: "backup"})
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	entries, err = history.Load(Filter{Since: start.Add(time.Minute), Until: start.Add(24 * time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "check", entries[0].Command)
+}
+
+func TestClean(t *testing.T) {
+	history := newAferoHistory(afero.NewMemMapFs(), "history.log")
+	start := time.Date(2020, 10, 10, 12, 0, 0, 0, time.UTC)
+	for day := 0; day < 10; day++ {
+		require.NoError(t, history.Append(testEntry("root", "backup", start.Add(time.Duration(day)*24*time.Hour), nil)))
+	}
+
+	removed, err := history.Clean(start.Add(7 * 24 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 7, removed)
+
+	entries, err := history.Load(Filter{})
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+
+	removed, err = history.Clean(start)
+	require.NoError(t, err)
+	assert.Equal(t, 0, removed)
+}
+
+func TestConcurrentAppendAndClean(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resticprofile-history")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	history := NewHistory(filepath.Join(dir, "history.log"))
+
+	start := time.Date(2020, 10, 10, 12, 0, 0, 0, time.UTC)
+	const runs = 50
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < runs; i++ {
+			assert.NoError(t, history.Append(testEntry("root", "backup", start.Add(time.Duration(i)*time.Hour), nil)))
+			// an old entry for the next clean
+			assert.NoError(t, history.Append(testEntry("root", "backup", start.Add(-24*time.Hour), nil)))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < runs; i++ {
+			_, err := history.Clean(start)
+			assert.NoError(t, err)
+		}
+	}()
+	wg.Wait()
+
+	// none of the recent entries was lost
+	entries, err := history.Load(Filter{Since: start})
+	require.NoError(t, err)
+	assert.Len(t, entries, runs)
+	assert.NoFileExists(t, filepath.Join(dir, "history.log.lock"))
+}
+
+func TestComputeStats(t *testing.T) {
+	start := time.Date(2020, 10, 10, 12, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		testEntry("src", "backup", start, nil),
+		testEntry("root", "backup", start, nil),
+		testEntry("root", "backup", start.Add(time.Hour), errors.New("error")),
+		testEntry("root", "backup", start.Add(2*time.Hour), nil),
+		testEntry("root", "backup", start.Add(3*time.Hour), nil),
+	}
+	stats := ComputeStats(entries)
+	require.Len(t, stats, 2)
+	assert.Equal(t, "root", stats[0].Profile)
+	assert.Equal(t, 4, stats[0].Runs)
+	assert.Equal(t, 75.0, stats[0].SuccessRate())
+	assert.Equal(t, 90.0, stats[0].AverageDuration())
+	assert.Equal(t, start.Add(3*time.Hour), stats[0].LastRun)
+	assert.Equal(t, "src", stats[1].Profile)
+	assert.Equal(t, 100.0, stats[1].SuccessRate())
+}
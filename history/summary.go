@@ -0,0 +1,155 @@
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// summaryPatterns match the lines of the summary displayed by restic at the end of a backup
+var summaryPatterns = []struct {
+	pattern *regexp.Regexp
+	keys    []string
+}{
+	{regexp.MustCompile(`^Files:\s+(\d+) new,\s+(\d+) changed,\s+(\d+) unmodified`), []string{"files-new", "files-changed", "files-unmodified"}},
+	{regexp.MustCompile(`^Dirs:\s+(\d+) new,\s+(\d+) changed,\s+(\d+) unmodified`), []string{"dirs-new", "dirs-changed", "dirs-unmodified"}},
+	{regexp.MustCompile(`^Added to the repo(?:sitory)?:\s+(.+)$`), []string{"added"}},
+	{regexp.MustCompile(`^processed (\d+) files, (.+) in (\S+)$`), []string{"files-processed", "bytes-processed", "restic-duration"}},
+	{regexp.MustCompile(`^snapshot (\w+) saved$`), []string{"snapshot-id"}},
+}
+
+// jsonSummary is the summary message displayed at the end of a backup when restic is running with the --json flag
+type jsonSummary struct {
+	MessageType         string  `json:"message_type"`
+	FilesNew            int     `json:"files_new"`
+	FilesChanged        int     `json:"files_changed"`
+	FilesUnmodified     int     `json:"files_unmodified"`
+	DirsNew             int     `json:"dirs_new"`
+	DirsChanged         int     `json:"dirs_changed"`
+	DirsUnmodified      int     `json:"dirs_unmodified"`
+	DataAdded           uint64  `json:"data_added"`
+	TotalFilesProcessed int     `json:"total_files_processed"`
+	TotalBytesProcessed uint64  `json:"total_bytes_processed"`
+	TotalDuration       float64 `json:"total_duration"`
+	SnapshotID          string  `json:"snapshot_id"`
+}
+
+// SummaryWriter collects the summary from the output of a restic command
+type SummaryWriter struct {
+	mutex   sync.Mutex
+	line    []byte
+	summary map[string]string
+}
+
+// NewSummaryWriter creates a writer receiving the output of restic
+func NewSummaryWriter() *SummaryWriter {
+	return &SummaryWriter{
+		summary: make(map[string]string),
+	}
+}
+
+// Write parses the complete lines of the output
+func (s *SummaryWriter) Write(p []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.line = append(s.line, p...)
+	for {
+		index := bytes.IndexByte(s.line, '\n')
+		if index < 0 {
+			break
+		}
+		s.parseLine(string(s.line[:index]))
+		s.line = s.line[index+1:]
+	}
+	return len(p), nil
+}
+
+// Summary returns the values found in the output. It's empty if restic didn't display a summary
+func (s *SummaryWriter) Summary() map[string]string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.line) > 0 {
+		s.parseLine(string(s.line))
+		s.line = nil
+	}
+	summary := make(map[string]string, len(s.summary))
+	for key, value := range s.summary {
+		summary[key] = value
+	}
+	return summary
+}
+
+func (s *SummaryWriter) parseLine(line string) {
+	// only keep the last refresh of a progress line
+	if index := strings.LastIndexByte(strings.TrimRight(line, "\r"), '\r'); index >= 0 {
+		line = line[index+1:]
+	}
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "{") {
+		s.parseJSONLine(line)
+		return
+	}
+	for _, summaryPattern := range summaryPatterns {
+		matches := summaryPattern.pattern.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		for i, key := range summaryPattern.keys {
+			s.summary[key] = matches[i+1]
+		}
+		return
+	}
+}
+
+// parseJSONLine keeps the values of the summary message, using the same format as the text output of restic
+func (s *SummaryWriter) parseJSONLine(line string) {
+	message := jsonSummary{}
+	err := json.Unmarshal([]byte(line), &message)
+	if err != nil || message.MessageType != "summary" {
+		return
+	}
+	s.summary["files-new"] = strconv.Itoa(message.FilesNew)
+	s.summary["files-changed"] = strconv.Itoa(message.FilesChanged)
+	s.summary["files-unmodified"] = strconv.Itoa(message.FilesUnmodified)
+	s.summary["dirs-new"] = strconv.Itoa(message.DirsNew)
+	s.summary["dirs-changed"] = strconv.Itoa(message.DirsChanged)
+	s.summary["dirs-unmodified"] = strconv.Itoa(message.DirsUnmodified)
+	s.summary["added"] = formatBytes(message.DataAdded)
+	s.summary["files-processed"] = strconv.Itoa(message.TotalFilesProcessed)
+	s.summary["bytes-processed"] = formatBytes(message.TotalBytesProcessed)
+	s.summary["restic-duration"] = formatDuration(message.TotalDuration)
+	if message.SnapshotID != "" {
+		s.summary["snapshot-id"] = message.SnapshotID
+	}
+}
+
+// formatBytes displays a size like restic does (1.227 MiB)
+func formatBytes(size uint64) string {
+	switch {
+	case size >= 1<<40:
+		return fmt.Sprintf("%.3f TiB", float64(size)/(1<<40))
+	case size >= 1<<30:
+		return fmt.Sprintf("%.3f GiB", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.3f MiB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.3f KiB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", size)
+}
+
+// formatDuration displays a duration in seconds like restic does (0:02 or 1:02:03)
+func formatDuration(seconds float64) string {
+	total := int(seconds)
+	hours, minutes, secs := total/3600, total/60%60, total%60
+	if hours > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", hours, minutes, secs)
+	}
+	return fmt.Sprintf("%d:%02d", minutes, secs)
+}
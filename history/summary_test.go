@@ -0,0 +1,86 @@
+package history
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const backupOutput = `open repository
+lock repository
+load index files
+using parent snapshot 4e1b6e2c
+
+Files:           2 new,     1 changed,   120 unmodified
+Dirs:            0 new,     3 changed,    12 unmodified
+Added to the repo: 1.227 MiB
+
+processed 123 files, 45.6 MiB in 0:02
+snapshot 1d3f9a52 saved
+`
+
+func TestBackupSummary(t *testing.T) {
+	writer := NewSummaryWriter()
+	// send the output in small chunks
+	for i := 0; i < len(backupOutput); i += 7 {
+		end := i + 7
+		if end > len(backupOutput) {
+			end = len(backupOutput)
+		}
+		_, err := writer.Write([]byte(backupOutput[i:end]))
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, map[string]string{
+		"files-new":        "2",
+		"files-changed":    "1",
+		"files-unmodified": "120",
+		"dirs-new":         "0",
+		"dirs-changed":     "3",
+		"dirs-unmodified":  "12",
+		"added":            "1.227 MiB",
+		"files-processed":  "123",
+		"bytes-processed":  "45.6 MiB",
+		"restic-duration":  "0:02",
+		"snapshot-id":      "1d3f9a52",
+	}, writer.Summary())
+}
+
+func TestSummaryWithoutNewLine(t *testing.T) {
+	writer := NewSummaryWriter()
+	_, _ = writer.Write([]byte("[0:01] 50.00%  1 files\r[0:02] 100.00%\rsnapshot 1d3f9a52 saved"))
+	assert.Equal(t, map[string]string{"snapshot-id": "1d3f9a52"}, writer.Summary())
+}
+
+func TestNoSummary(t *testing.T) {
+	writer := NewSummaryWriter()
+	_, _ = writer.Write([]byte("ID        Time                 Host\n"))
+	assert.Empty(t, writer.Summary())
+}
+
+func TestJSONBackupSummary(t *testing.T) {
+	writer := NewSummaryWriter()
+	_, _ = writer.Write([]byte(`{"message_type":"status","percent_done":0.5,"total_files":123}
+{"message_type":"summary","files_new":2,"files_changed":1,"files_unmodified":120,"dirs_new":0,"dirs_changed":3,"dirs_unmodified":12,"data_blobs":3,"tree_blobs":4,"data_added":1286602,"total_files_processed":123,"total_bytes_processed":47815065,"total_duration":62.5,"snapshot_id":"1d3f9a52c0b8e6ab8e5a3d1b8f7a2c4d5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a0b"}
+`))
+	assert.Equal(t, map[string]string{
+		"files-new":        "2",
+		"files-changed":    "1",
+		"files-unmodified": "120",
+		"dirs-new":         "0",
+		"dirs-changed":     "3",
+		"dirs-unmodified":  "12",
+		"added":            "1.227 MiB",
+		"files-processed":  "123",
+		"bytes-processed":  "45.600 MiB",
+		"restic-duration":  "1:02",
+		"snapshot-id":      "1d3f9a52c0b8e6ab8e5a3d1b8f7a2c4d5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a0b",
+	}, writer.Summary())
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "0 B", formatBytes(0))
+	assert.Equal(t, "1023 B", formatBytes(1023))
+	assert.Equal(t, "1.000 KiB", formatBytes(1024))
+	assert.Equal(t, "2.500 GiB", formatBytes(2684354560))
+	assert.Equal(t, "1.000 TiB", formatBytes(1<<40))
+}
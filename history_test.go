@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/creativeprojects/resticprofile/history"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHistoryDate(t *testing.T) {
+	testData := []struct {
+		input    string
+		expected time.Time
+	}{
+		{"", time.Time{}},
+		{"2020-10-30", time.Date(2020, 10, 30, 0, 0, 0, 0, time.Local)},
+		{"2020-10-30 18:05", time.Date(2020, 10, 30, 18, 5, 0, 0, time.Local)},
+		{"2020-10-30 18:05:10", time.Date(2020, 10, 30, 18, 5, 10, 0, time.Local)},
+		{"2020-10-30T18:05:10Z", time.Date(2020, 10, 30, 18, 5, 10, 0, time.UTC)},
+	}
+	for _, testItem := range testData {
+		t.Run(testItem.input, func(t *testing.T) {
+			date, err := parseHistoryDate(testItem.input)
+			require.NoError(t, err)
+			assert.True(t, testItem.expected.Equal(date), "expected %s but found %s", testItem.expected, date)
+		})
+	}
+
+	_, err := parseHistoryDate("yesterday")
+	assert.Error(t, err)
+}
+
+func TestDisplayHistory(t *testing.T) {
+	start := time.Date(2020, 10, 30, 18, 0, 0, 0, time.Local)
+	failed := history.NewEntry("root", "backup", start.Add(time.Hour), start.Add(time.Hour+3*time.Second))
+	failed.Success = false
+	failed.ExitCode = 1
+	failed.Error = "backup on profile 'root': exit status 1"
+	entries := []history.Entry{
+		history.NewEntry("root", "backup", start, start.Add(65*time.Second)),
+		failed,
+	}
+
+	buffer := &bytes.Buffer{}
+	displayHistory(buffer, entries)
+	output := buffer.String()
+	assert.Contains(t, output, "2020-10-30 18:00:00  root     backup   1m5s      success")
+	assert.Contains(t, output, "failed (1): backup on profile 'root': exit status 1")
+	assert.Contains(t, output, "root     backup   2     50.0%         34s")
+
+	buffer.Reset()
+	displayHistory(buffer, nil)
+	assert.Contains(t, buffer.String(), "no run found in history")
+}
+
+func TestDisplayHistoryJSON(t *testing.T) {
+	start := time.Date(2020, 10, 30, 18, 0, 0, 0, time.UTC)
+	entries := []history.Entry{
+		history.NewEntry("root", "backup", start, start.Add(10*time.Second)),
+	}
+
+	buffer := &bytes.Buffer{}
+	err := displayHistoryJSON(buffer, entries)
+	require.NoError(t, err)
+
+	output := struct {
+		Runs  []history.Entry `json:"runs"`
+		Stats []historyStats  `json:"stats"`
+	}{}
+	err = json.Unmarshal(buffer.Bytes(), &output)
+	require.NoError(t, err)
+	require.Len(t, output.Runs, 1)
+	assert.Equal(t, "root", output.Runs[0].Profile)
+	require.Len(t, output.Stats, 1)
+	assert.Equal(t, 100.0, output.Stats[0].SuccessRate)
+	assert.Equal(t, 10.0, output.Stats[0].AverageDuration)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/creativeprojects/resticprofile/dotenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestProfileWizard returns a wizard answering the questions from the lists
+func newTestProfileWizard(configDir string, lines []string, answers []bool) *profileWizard {
+	return &profileWizard{
+		askYesNo: func(message string, defaultAnswer bool) bool {
+			if len(answers) == 0 {
+				return defaultAnswer
+			}
+			answer := answers[0]
+			answers = answers[1:]
+			return answer
+		},
+		readLine: func() (string, error) {
+			if len(lines) == 0 {
+				return "", errors.New("no more input")
+			}
+			line := lines[0]
+			lines = lines[1:]
+			return line, nil
+		},
+		readPassword: func() (string, error) {
+			return "my password", nil
+		},
+		configDir: configDir,
+	}
+}
+
+func TestProfileWizardLocalRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resticprofile")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	wizard := newTestProfileWizard(dir, []string{
+		"",                  // profile name
+		"",                  // repository type
+		"",                  // empty path is asked again
+		"/backup",           // path
+		"",                  // generate password
+		"/home", "/etc", "", // sources
+		"*.tmp", "", // excludes
+		"", "0", "", // retention
+		"", // schedule
+	}, []bool{true, true, true})
+	name, profile, err := wizard.run("default", nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, "default", name)
+	assert.Equal(t, map[string]interface{}{
+		"repository":    "local:/backup",
+		"password-file": "default-key",
+		"backup": map[string]interface{}{
+			"source":         []string{"/home", "/etc"},
+			"exclude":        []string{"*.tmp"},
+			"exclude-caches": true,
+			"schedule":       []string{"daily"},
+		},
+		"retention": map[string]interface{}{
+			"after-backup": true,
+			"prune":        true,
+			"keep-daily":   7,
+			"keep-monthly": 12,
+		},
+	}, profile)
+	assert.FileExists(t, filepath.Join(dir, "default-key"))
+}
+
+func TestProfileWizardS3Repository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resticprofile")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	wizard := newTestProfileWizard(dir, []string{
+		"nas",
+		"S3",
+		"s3.amazonaws.com/bucket",
+		"key_id",
+		"command",
+		"pass show backup",
+		"/home", "",
+		"",
+	}, []bool{false, false, false})
+	name, profile, err := wizard.run("default", map[string][]string{"default": nil})
+	require.NoError(t, err)
+
+	assert.Equal(t, "nas", name)
+	assert.Equal(t, map[string]interface{}{
+		"repository": "s3:s3.amazonaws.com/bucket",
+		"password":   "cmd: pass show backup",
+		"env": map[string]interface{}{
+			"AWS_ACCESS_KEY_ID": "key_id",
+		},
+		"env-file": []string{"nas.env"},
+		"backup": map[string]interface{}{
+			"source": []string{"/home"},
+		},
+	}, profile)
+
+	// the secret is not saved in the configuration file
+	envFile := filepath.Join(dir, "nas.env")
+	content, err := ioutil.ReadFile(envFile)
+	require.NoError(t, err)
+	assert.Equal(t, "AWS_SECRET_ACCESS_KEY='my password'\n", string(content))
+	values, err := dotenv.Load(envFile)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"AWS_SECRET_ACCESS_KEY": "my password"}, values)
+}
+
+func TestProfileWizardSecretReference(t *testing.T) {
+	wizard := newTestProfileWizard("", []string{
+		"", "b2", "bucket:/path", "account", "command", "pass show backup", "/home", "", "",
+	}, []bool{false, false, false})
+	wizard.readPassword = func() (string, error) {
+		return "keyring:restic/b2", nil
+	}
+	_, profile, err := wizard.run("default", nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]interface{}{
+		"B2_ACCOUNT_ID":  "account",
+		"B2_ACCOUNT_KEY": "keyring:restic/b2",
+	}, profile["env"])
+	assert.NotContains(t, profile, "env-file")
+}
+
+func TestProfileWizardEnterPassword(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resticprofile")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	wizard := newTestProfileWizard(dir, []string{
+		"", "", "/backup", "enter", "/home", "", "", "",
+	}, []bool{false, false, false})
+	_, profile, err := wizard.run("default", nil)
+	require.NoError(t, err)
+
+	assert.NotContains(t, profile, "password")
+	assert.Equal(t, "default-key", profile["password-file"])
+	keyFile := filepath.Join(dir, "default-key")
+	content, err := ioutil.ReadFile(keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, "my password", string(content))
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(keyFile)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+
+	// an existing password file is never overwritten
+	wizard = newTestProfileWizard(dir, []string{
+		"", "", "/backup", "enter",
+	}, nil)
+	_, _, err = wizard.run("default", nil)
+	assert.Error(t, err)
+}
+
+func TestProfileWizardExistingProfile(t *testing.T) {
+	wizard := newTestProfileWizard("", []string{""}, nil)
+	_, _, err := wizard.run("default", map[string][]string{"default": nil})
+	assert.EqualError(t, err, "profile 'default' already exists")
+}
+
+func TestProfileWizardInvalidSchedule(t *testing.T) {
+	wizard := newTestProfileWizard("", []string{
+		"", "", "/backup", "file", "key", "/home", "", "", "every other day",
+	}, []bool{false, false, true})
+	_, _, err := wizard.run("default", nil)
+	assert.Error(t, err)
+}
@@ -38,6 +38,12 @@ func setupConsoleLogger(flags commandLineFlags) {
 	clog.SetDefaultLogger(logger)
 }
 
+// setupErrorLogger sends the log messages to the error output
+func setupErrorLogger(flags commandLineFlags) {
+	logger := newFilteredLogger(flags, clog.NewStandardLogHandler(os.Stderr, "", log.LstdFlags))
+	clog.SetDefaultLogger(logger)
+}
+
 func newFilteredLogger(flags commandLineFlags, handler clog.Handler) *clog.Logger {
 	if flags.quiet && (flags.verbose || flags.veryVerbose) {
 		coin := ""
@@ -1,11 +1,11 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"runtime"
 	"runtime/debug"
 	"syscall"
@@ -100,6 +100,10 @@ func main() {
 			defer file.Close()
 		}
 
+	} else if isNagiosCommand(flags) {
+		// the standard output of a monitoring plugin only receives the result of the check
+		setupErrorLogger(flags)
+
 	} else {
 		// Use the console logger
 		setupConsoleLogger(flags)
@@ -135,19 +139,25 @@ func main() {
 		}
 	}
 
-	configFile, err := filesearch.FindConfigurationFile(flags.config)
+	// monitoring plugin: it doesn't need restic, and reports any error as an UNKNOWN state
+	if isNagiosCommand(flags) {
+		var codeErr exitCodeError
+		if errors.As(runNagiosPlugin(flags), &codeErr) {
+			exitCode = int(codeErr)
+		}
+		return
+	}
+
+	c, err := loadConfiguration(flags)
 	if err != nil {
-		clog.Error(err)
+		clog.Errorf("cannot load configuration: %v", err)
 		exitCode = 1
 		return
 	}
-	if configFile != flags.config {
-		clog.Infof("using configuration file: %s", configFile)
-	}
-
-	c, err := config.LoadFile(configFile, flags.format)
+	c.AddEnvironmentOverrides(os.Environ())
+	err = c.AddCommandLineOverrides(flags.set)
 	if err != nil {
-		clog.Errorf("cannot load configuration file: %v", err)
+		clog.Errorf("invalid --set flag: %v", err)
 		exitCode = 1
 		return
 	}
@@ -201,6 +211,11 @@ func main() {
 	if isOwnCommand(resticCommand, true) {
 		err = runOwnCommand(c, resticCommand, flags, resticArguments)
 		if err != nil {
+			var codeErr exitCodeError
+			if errors.As(err, &codeErr) {
+				exitCode = int(codeErr)
+				return
+			}
 			clog.Error(err)
 			exitCode = 1
 			return
@@ -280,14 +295,39 @@ func runProfile(
 	resticArguments []string,
 	resticCommand string,
 ) error {
-	var err error
+	profile, err := loadProfile(c, flags, profileName, resticCommand)
+	if err != nil {
+		return err
+	}
+
+	// Catch CTR-C keypress
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGABRT)
+
+	wrapper := newResticWrapper(
+		resticBinary,
+		global.Initialize || profile.Initialize,
+		flags.dryRun,
+		profile,
+		resticCommand,
+		resticArguments,
+		sigChan,
+	)
+	err = wrapper.runProfile()
+	if err != nil {
+		return err
+	}
+	return nil
+}
 
-	profile, err := c.GetProfile(profileName)
+// loadProfile loads the profile from the configuration, ready to run the command
+func loadProfile(c *config.Config, flags commandLineFlags, profileName, resticCommand string) (*config.Profile, error) {
+	profile, err := c.GetProfile(profileName, resticCommand)
 	if err != nil {
 		clog.Warning(err)
 	}
 	if profile == nil {
-		return fmt.Errorf("cannot load profile '%s'", profileName)
+		return nil, fmt.Errorf("cannot load profile '%s'", profileName)
 	}
 
 	// Send the quiet/verbose down to restic as well (override profile configuration)
@@ -302,38 +342,30 @@ func runProfile(
 
 	// All files in the configuration are relative to the configuration file, NOT the folder where resticprofile is started
 	// So we need to fix all relative files
-	rootPath := filepath.Dir(c.GetConfigFile())
+	rootPath := c.GetBaseDir()
 	if rootPath != "." {
 		clog.Debugf("files in configuration are relative to '%s'", rootPath)
 	}
 	profile.SetRootPath(rootPath)
 
 	// Specific case for the "host" flag where an empty value should be replaced by the hostname
-	hostname := "none"
-	currentHost, err := os.Hostname()
-	if err == nil {
-		hostname = currentHost
-	}
-	profile.SetHost(hostname)
+	profile.SetHost(getHostname())
 
-	// Catch CTR-C keypress
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGABRT)
+	if flags.dryRun {
+		for _, override := range c.GetOverrides(profileName) {
+			clog.Infof("dry-run: override %s", override)
+		}
+	}
+	return profile, nil
+}
 
-	wrapper := newResticWrapper(
-		resticBinary,
-		global.Initialize || profile.Initialize,
-		flags.dryRun,
-		profile,
-		resticCommand,
-		resticArguments,
-		sigChan,
-	)
-	err = wrapper.runProfile()
+// getHostname returns the name of the current host, or "none" if it cannot be determined
+func getHostname() string {
+	hostname, err := os.Hostname()
 	if err != nil {
-		return err
+		return "none"
 	}
-	return nil
+	return hostname
 }
 
 // randomBool returns true for Heads and false for Tails
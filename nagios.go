@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/creativeprojects/resticprofile/config"
+	"github.com/creativeprojects/resticprofile/constants"
+	"github.com/creativeprojects/resticprofile/filesearch"
+	"github.com/creativeprojects/resticprofile/history"
+	"github.com/creativeprojects/resticprofile/status"
+	"github.com/spf13/pflag"
+)
+
+// Exit codes of a monitoring plugin (Nagios, Icinga, etc.)
+const (
+	nagiosOK = iota
+	nagiosWarning
+	nagiosCritical
+	nagiosUnknown
+)
+
+var nagiosStates = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// nagiosCheck contains everything known about the last runs of a profile command
+type nagiosCheck struct {
+	profileName string
+	command     string
+	warning     time.Duration
+	critical    time.Duration
+	// lastRun is the status of the last run (nil if not found in the status file)
+	lastRun *status.CommandStatus
+	// lastSuccess is the time of the last successful run, or the latest snapshot
+	lastSuccess time.Time
+	// lastEntry is the last run recorded in the history file (nil if not found)
+	lastEntry *history.Entry
+}
+
+// isNagiosCommand returns true when resticprofile runs as a monitoring plugin
+func isNagiosCommand(flags commandLineFlags) bool {
+	return len(flags.resticArgs) > 0 && flags.resticArgs[0] == "nagios"
+}
+
+// runNagiosPlugin loads the configuration and runs the plugin: an invalid configuration is reported as an UNKNOWN state
+func runNagiosPlugin(flags commandLineFlags) error {
+	c, err := loadConfiguration(flags)
+	if err != nil {
+		return nagiosExit(os.Stdout, nagiosUnknown, fmt.Sprintf("cannot load configuration: %v", err), "")
+	}
+	c.AddEnvironmentOverrides(os.Environ())
+	err = c.AddCommandLineOverrides(flags.set)
+	if err != nil {
+		return nagiosExit(os.Stdout, nagiosUnknown, fmt.Sprintf("invalid --set flag: %v", err), "")
+	}
+	return nagiosPlugin(c, flags, flags.resticArgs[1:])
+}
+
+// nagiosPlugin displays the health of a profile command as a monitoring plugin, and exits with the plugin exit code
+func nagiosPlugin(c *config.Config, flags commandLineFlags, args []string) error {
+	check := nagiosCheck{profileName: flags.name}
+	useRestic := false
+	flagset := pflag.NewFlagSet("nagios", pflag.ContinueOnError)
+	flagset.StringVar(&check.command, "command", constants.CommandBackup, "profile command to check")
+	flagset.DurationVar(&check.warning, "warning", 0, "age of the last successful run returning a WARNING (like 26h)")
+	flagset.DurationVar(&check.critical, "critical", 0, "age of the last successful run returning a CRITICAL (default is the max-age of the command)")
+	flagset.BoolVar(&useRestic, "restic", false, "also ask restic for the time of the latest snapshot (for the backup command)")
+	err := flagset.Parse(args)
+	if err != nil {
+		return nagiosExit(os.Stdout, nagiosUnknown, err.Error(), "")
+	}
+
+	err = check.load(c, flags, useRestic)
+	if err != nil {
+		return nagiosExit(os.Stdout, nagiosUnknown, err.Error(), "")
+	}
+	now := time.Now()
+	state, message := check.evaluate(now)
+	return nagiosExit(os.Stdout, state, message, check.perfdata(now))
+}
+
+// load reads the status file, the history file and the latest snapshot of the profile
+func (n *nagiosCheck) load(c *config.Config, flags commandLineFlags, useRestic bool) error {
+	profile, err := loadProfile(c, flags, n.profileName, constants.CommandSnapshots)
+	if err != nil {
+		return err
+	}
+	if n.critical == 0 {
+		n.critical = profile.MaxAges()[n.command]
+	}
+	if n.warning == 0 && n.critical == 0 {
+		return fmt.Errorf("no threshold: add a max-age to the %s section of profile '%s', or use the --warning and --critical flags", n.command, n.profileName)
+	}
+	if profile.StatusFile != "" {
+		n.lastRun = status.NewStatus(profile.StatusFile).Load().Profile(n.profileName).Command(n.command)
+		if n.lastRun != nil {
+			n.lastSuccess = n.lastRun.GetLastSuccess()
+		}
+	}
+	if profile.HistoryFile != "" {
+		// a scheduled retention is recorded as a forget command in the history
+		entries, err := history.NewHistory(profile.HistoryFile).Load(history.Filter{Profile: n.profileName, Command: getResticCommand(n.command)})
+		if err != nil {
+			return fmt.Errorf("cannot load history file '%s': %w", profile.HistoryFile, err)
+		}
+		if len(entries) > 0 {
+			n.lastEntry = &entries[len(entries)-1]
+		}
+	}
+	if useRestic && n.command == constants.CommandBackup {
+		global, err := c.GetGlobalSection()
+		if err != nil {
+			return fmt.Errorf("cannot load global configuration: %w", err)
+		}
+		resticBinary, err := filesearch.FindResticBinary(global.ResticBinary)
+		if err != nil {
+			return fmt.Errorf("cannot find restic: %w", err)
+		}
+		snapshotTime, err := newResticWrapper(resticBinary, false, false, profile, constants.CommandSnapshots, nil, nil).latestSnapshotTime()
+		if err != nil {
+			return fmt.Errorf("cannot load the latest snapshot: %w", err)
+		}
+		if snapshotTime.After(n.lastSuccess) {
+			n.lastSuccess = snapshotTime
+		}
+	}
+	return nil
+}
+
+// evaluate returns the state of the check with a one line message
+func (n *nagiosCheck) evaluate(now time.Time) (int, string) {
+	if n.lastRun == nil && n.lastSuccess.IsZero() {
+		return nagiosUnknown, fmt.Sprintf("no %s recorded for profile '%s'", n.command, n.profileName)
+	}
+	if n.lastSuccess.IsZero() {
+		return nagiosCritical, fmt.Sprintf("no successful %s for profile '%s', last error: %s", n.command, n.profileName, n.lastRun.Error)
+	}
+	age := now.Sub(n.lastSuccess)
+	message := fmt.Sprintf("last successful %s of profile '%s' was %s ago", n.command, n.profileName, age.Round(time.Second))
+	state := nagiosOK
+	if n.critical > 0 && age > n.critical {
+		state = nagiosCritical
+	} else if n.warning > 0 && age > n.warning {
+		state = nagiosWarning
+	}
+	if n.lastRun != nil && !n.lastRun.Success {
+		message += ", last run failed: " + n.lastRun.Error
+		if state == nagiosOK {
+			state = nagiosWarning
+		}
+	}
+	return state, message
+}
+
+// perfdata returns the performance data of the check: age of the last successful run, duration of the last run and bytes added
+func (n *nagiosCheck) perfdata(now time.Time) string {
+	data := make([]string, 0, 3)
+	if !n.lastSuccess.IsZero() {
+		data = append(data, fmt.Sprintf("age=%ds;%s;%s;0",
+			int64(now.Sub(n.lastSuccess).Seconds()), nagiosThreshold(n.warning), nagiosThreshold(n.critical)))
+	}
+	if n.lastEntry != nil {
+		data = append(data, fmt.Sprintf("duration=%.3fs;;;0", n.lastEntry.Duration))
+		if bytes, err := parseResticSize(n.lastEntry.Summary["added"]); err == nil {
+			data = append(data, fmt.Sprintf("added=%dB;;;0", bytes))
+		}
+	}
+	return strings.Join(data, " ")
+}
+
+// nagiosThreshold returns the threshold in seconds, or an empty string when not set
+func nagiosThreshold(threshold time.Duration) string {
+	if threshold <= 0 {
+		return ""
+	}
+	return strconv.FormatInt(int64(threshold.Seconds()), 10)
+}
+
+// nagiosExit displays the plugin output line and returns the exit code as an error
+func nagiosExit(w io.Writer, state int, message, perfdata string) error {
+	line := "RESTICPROFILE " + nagiosStates[state] + " - " + message
+	if perfdata != "" {
+		line += " | " + perfdata
+	}
+	fmt.Fprintln(w, line)
+	if state == nagiosOK {
+		return nil
+	}
+	return exitCodeError(state)
+}
+
+// resticSizeUnits are the units used by restic to display a size
+var resticSizeUnits = map[string]float64{
+	"B":   1,
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+	"TiB": 1 << 40,
+}
+
+// parseResticSize converts a size displayed by restic (like "1.227 MiB") into bytes
+func parseResticSize(size string) (int64, error) {
+	fields := strings.Fields(size)
+	if len(fields) != 2 {
+		return 0, fmt.Errorf("invalid size '%s'", size)
+	}
+	unit, found := resticSizeUnits[fields[1]]
+	if !found {
+		return 0, fmt.Errorf("invalid unit in size '%s'", size)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size '%s': %w", size, err)
+	}
+	return int64(value * unit), nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/creativeprojects/resticprofile/history"
+	"github.com/creativeprojects/resticprofile/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNagiosEvaluate(t *testing.T) {
+	now := time.Date(2020, 10, 30, 18, 0, 0, 0, time.UTC)
+	testData := []struct {
+		name     string
+		check    nagiosCheck
+		state    int
+		contains string
+	}{
+		{
+			name:     "never run",
+			check:    nagiosCheck{},
+			state:    nagiosUnknown,
+			contains: "no backup recorded",
+		},
+		{
+			name:     "never succeeded",
+			check:    nagiosCheck{lastRun: &status.CommandStatus{Success: false, Error: "exit status 1"}},
+			state:    nagiosCritical,
+			contains: "last error: exit status 1",
+		},
+		{
+			name:     "ok",
+			check:    nagiosCheck{lastSuccess: now.Add(-time.Hour)},
+			state:    nagiosOK,
+			contains: "was 1h0m0s ago",
+		},
+		{
+			name:  "warning",
+			check: nagiosCheck{lastSuccess: now.Add(-25 * time.Hour)},
+			state: nagiosWarning,
+		},
+		{
+			name:  "critical",
+			check: nagiosCheck{lastSuccess: now.Add(-49 * time.Hour)},
+			state: nagiosCritical,
+		},
+		{
+			name: "recent success but last run failed",
+			check: nagiosCheck{
+				lastRun:     &status.CommandStatus{Success: false, Error: "exit status 3"},
+				lastSuccess: now.Add(-time.Hour),
+			},
+			state:    nagiosWarning,
+			contains: "last run failed: exit status 3",
+		},
+	}
+	for _, testItem := range testData {
+		t.Run(testItem.name, func(t *testing.T) {
+			check := testItem.check
+			check.profileName = "root"
+			check.command = "backup"
+			check.warning = 24 * time.Hour
+			check.critical = 48 * time.Hour
+			state, message := check.evaluate(now)
+			assert.Equal(t, testItem.state, state)
+			assert.Contains(t, message, testItem.contains)
+		})
+	}
+}
+
+func TestNagiosPerfdata(t *testing.T) {
+	now := time.Date(2020, 10, 30, 18, 0, 0, 0, time.UTC)
+	check := nagiosCheck{critical: 26 * time.Hour}
+	assert.Equal(t, "", check.perfdata(now))
+
+	check.lastSuccess = now.Add(-time.Hour)
+	assert.Equal(t, "age=3600s;;93600;0", check.perfdata(now))
+
+	entry := history.NewEntry("root", "backup", now.Add(-time.Hour), now.Add(-time.Hour+12500*time.Millisecond))
+	entry.Summary = map[string]string{"added": "1.5 MiB"}
+	check.lastEntry = &entry
+	check.warning = 24 * time.Hour
+	assert.Equal(t, "age=3600s;86400;93600;0 duration=12.500s;;;0 added=1572864B;;;0", check.perfdata(now))
+}
+
+func TestNagiosExit(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	err := nagiosExit(buffer, nagiosOK, "all good", "age=10s;;;0")
+	assert.NoError(t, err)
+	assert.Equal(t, "RESTICPROFILE OK - all good | age=10s;;;0\n", buffer.String())
+
+	buffer.Reset()
+	err = nagiosExit(buffer, nagiosUnknown, "no status", "")
+	assert.Equal(t, "RESTICPROFILE UNKNOWN - no status\n", buffer.String())
+	var codeErr exitCodeError
+	require.True(t, errors.As(err, &codeErr))
+	assert.Equal(t, 3, int(codeErr))
+}
+
+func TestRunNagiosPluginWithInvalidConfiguration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resticprofile-nagios")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "profiles.toml")
+	require.NoError(t, ioutil.WriteFile(configFile, []byte("[root]\n"), 0600))
+
+	testData := []struct {
+		name  string
+		flags commandLineFlags
+	}{
+		{
+			name:  "configuration not found",
+			flags: commandLineFlags{config: filepath.Join(dir, "missing.toml")},
+		},
+		{
+			name:  "invalid --set flag",
+			flags: commandLineFlags{config: configFile, set: []string{"root.no-value"}},
+		},
+		{
+			name:  "no threshold",
+			flags: commandLineFlags{config: configFile, name: "root"},
+		},
+	}
+	for _, testItem := range testData {
+		t.Run(testItem.name, func(t *testing.T) {
+			flags := testItem.flags
+			flags.resticArgs = []string{"nagios"}
+			require.True(t, isNagiosCommand(flags))
+			err := runNagiosPlugin(flags)
+			var codeErr exitCodeError
+			require.True(t, errors.As(err, &codeErr))
+			assert.Equal(t, nagiosUnknown, int(codeErr))
+		})
+	}
+}
+
+func TestParseResticSize(t *testing.T) {
+	testData := []struct {
+		size     string
+		expected int64
+	}{
+		{"0 B", 0},
+		{"512 B", 512},
+		{"1.000 KiB", 1024},
+		{"1.227 MiB", 1286602},
+		{"2.500 GiB", 2684354560},
+		{"1.000 TiB", 1099511627776},
+	}
+	for _, testItem := range testData {
+		size, err := parseResticSize(testItem.size)
+		require.NoError(t, err)
+		assert.Equal(t, testItem.expected, size, testItem.size)
+	}
+
+	for _, invalid := range []string{"", "12", "12 PB", "a MiB"} {
+		_, err := parseResticSize(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
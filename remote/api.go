@@ -0,0 +1,224 @@
+package remote
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/creativeprojects/clog"
+	"github.com/creativeprojects/resticprofile/status"
+)
+
+const (
+	apiProfilesPath = "/profiles"
+	apiJobsPath     = "/jobs"
+)
+
+var (
+	// ErrNotFound is returned by the controller when the profile or the job doesn't exist
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned by the controller when the profile is already running
+	ErrConflict = errors.New("profile already running")
+	// ErrInvalidCommand is returned by the controller when the command cannot be started from the API
+	ErrInvalidCommand = errors.New("invalid command")
+	// ErrUnavailable is returned by the controller when the daemon is no longer running the jobs
+	ErrUnavailable = errors.New("service unavailable")
+)
+
+// ProfileInfo describes a profile and its scheduled jobs
+type ProfileInfo struct {
+	Name      string         `json:"name"`
+	Schedules []ScheduleInfo `json:"schedules,omitempty"`
+}
+
+// ScheduleInfo is a scheduled command of a profile
+type ScheduleInfo struct {
+	Command string     `json:"command"`
+	Next    *time.Time `json:"next,omitempty"`
+	LastRun *time.Time `json:"last-run,omitempty"`
+}
+
+// JobInfo is a profile currently running
+type JobInfo struct {
+	Profile  string     `json:"profile"`
+	Command  string     `json:"command,omitempty"`
+	Started  *time.Time `json:"started,omitempty"`
+	PID      int32      `json:"pid,omitempty"`
+	LockedBy string     `json:"locked-by,omitempty"`
+}
+
+// Controller gives access to the profiles and the jobs from the API
+type Controller interface {
+	Profiles() ([]ProfileInfo, error)
+	ProfileStatus(profileName string) (*status.Profile, error)
+	Jobs() ([]JobInfo, error)
+	Start(profileName, command string) error
+	Cancel(profileName string) error
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// APIServer is a HTTP server giving access to the profiles and their jobs, using JSON.
+// All the requests must be authenticated with the token: "Authorization: Bearer <token>"
+type APIServer struct {
+	token      string
+	controller Controller
+	server     *http.Server
+}
+
+// NewAPIServer creates a new API server
+func NewAPIServer(token string, controller Controller) *APIServer {
+	return &APIServer{
+		token:      token,
+		controller: controller,
+	}
+}
+
+// Start listening on the address in parameter (like "127.0.0.1:8080"), in the background
+func (a *APIServer) Start(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	clog.Infof("API listening on %s", listener.Addr())
+	a.server = &http.Server{
+		Handler: a.Handler(),
+	}
+	go func() {
+		err := a.server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			clog.Errorf("API server: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Stop gracefully asks the API server to shutdown
+func (a *APIServer) Stop() {
+	if a.server == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout*time.Second)
+	defer cancel()
+	_ = a.server.Shutdown(ctx)
+	a.server = nil
+}
+
+// Handler returns the HTTP handler of the API
+func (a *APIServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(apiProfilesPath, a.handleProfiles)
+	mux.HandleFunc(apiProfilesPath+"/", a.handleProfile)
+	mux.HandleFunc(apiJobsPath, a.handleJobs)
+	mux.HandleFunc(apiJobsPath+"/", a.handleJob)
+	return a.authenticate(mux)
+}
+
+func (a *APIServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if a.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, apiError{Error: "invalid or missing token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleProfiles lists all the profiles: GET /profiles
+func (a *APIServer) handleProfiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, apiError{Error: "method not allowed"})
+		return
+	}
+	profiles, err := a.controller.Profiles()
+	writeResponse(w, http.StatusOK, profiles, err)
+}
+
+// handleProfile returns the status of a profile (GET /profiles/<name>/status),
+// or starts a command (POST /profiles/<name>/<command>)
+func (a *APIServer) handleProfile(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, apiProfilesPath), "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		writeJSON(w, http.StatusNotFound, apiError{Error: ErrNotFound.Error()})
+		return
+	}
+	profileName, action := parts[0], parts[1]
+
+	switch {
+	case r.Method == http.MethodGet && action == "status":
+		profileStatus, err := a.controller.ProfileStatus(profileName)
+		writeResponse(w, http.StatusOK, profileStatus, err)
+
+	case r.Method == http.MethodPost:
+		err := a.controller.Start(profileName, action)
+		writeResponse(w, http.StatusAccepted, JobInfo{Profile: profileName, Command: action}, err)
+
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, apiError{Error: "method not allowed"})
+	}
+}
+
+// handleJobs lists the running jobs: GET /jobs
+func (a *APIServer) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, apiError{Error: "method not allowed"})
+		return
+	}
+	jobs, err := a.controller.Jobs()
+	writeResponse(w, http.StatusOK, jobs, err)
+}
+
+// handleJob cancels the running job of a profile: DELETE /jobs/<name>
+func (a *APIServer) handleJob(w http.ResponseWriter, r *http.Request) {
+	profileName := strings.Trim(strings.TrimPrefix(r.URL.Path, apiJobsPath), "/")
+	if profileName == "" || strings.Contains(profileName, "/") {
+		writeJSON(w, http.StatusNotFound, apiError{Error: ErrNotFound.Error()})
+		return
+	}
+	if r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, apiError{Error: "method not allowed"})
+		return
+	}
+	err := a.controller.Cancel(profileName)
+	writeResponse(w, http.StatusAccepted, JobInfo{Profile: profileName}, err)
+}
+
+// writeResponse sends the value with the status code, or the error with the matching status code
+func writeResponse(w http.ResponseWriter, statusCode int, value interface{}, err error) {
+	if err == nil {
+		writeJSON(w, statusCode, value)
+		return
+	}
+	switch {
+	case errors.Is(err, ErrNotFound):
+		statusCode = http.StatusNotFound
+	case errors.Is(err, ErrConflict):
+		statusCode = http.StatusConflict
+	case errors.Is(err, ErrInvalidCommand):
+		statusCode = http.StatusBadRequest
+	case errors.Is(err, ErrUnavailable):
+		statusCode = http.StatusServiceUnavailable
+	default:
+		statusCode = http.StatusInternalServerError
+	}
+	writeJSON(w, statusCode, apiError{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(value)
+	if err != nil {
+		clog.Errorf("API: cannot encode response: %v", err)
+	}
+}
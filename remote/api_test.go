@@ -0,0 +1,140 @@
+package remote
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/creativeprojects/resticprofile/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testToken = "secret-token"
+
+type mockController struct {
+	started   []string
+	cancelled []string
+}
+
+func (m *mockController) Profiles() ([]ProfileInfo, error) {
+	return []ProfileInfo{{Name: "root", Schedules: []ScheduleInfo{{Command: "backup"}}}, {Name: "src"}}, nil
+}
+
+func (m *mockController) ProfileStatus(profileName string) (*status.Profile, error) {
+	if profileName != "root" {
+		return nil, fmt.Errorf("profile '%s': %w", profileName, ErrNotFound)
+	}
+	return (&status.Profile{}).BackupSuccess(), nil
+}
+
+func (m *mockController) Jobs() ([]JobInfo, error) {
+	return []JobInfo{{Profile: "root", Command: "backup", PID: 123}}, nil
+}
+
+func (m *mockController) Start(profileName, command string) error {
+	if profileName == "root" {
+		return ErrConflict
+	}
+	if command == "invalid" {
+		return fmt.Errorf("command '%s': %w", command, ErrInvalidCommand)
+	}
+	if profileName == "stopped" {
+		return ErrUnavailable
+	}
+	m.started = append(m.started, profileName+"/"+command)
+	return nil
+}
+
+func (m *mockController) Cancel(profileName string) error {
+	if profileName != "root" {
+		return ErrNotFound
+	}
+	m.cancelled = append(m.cancelled, profileName)
+	return nil
+}
+
+func apiRequest(t *testing.T, handler http.Handler, method, path, token string) (int, string) {
+	request := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	body, err := ioutil.ReadAll(recorder.Result().Body)
+	require.NoError(t, err)
+	return recorder.Code, strings.TrimSpace(string(body))
+}
+
+func TestAPIAuthentication(t *testing.T) {
+	handler := NewAPIServer(testToken, &mockController{}).Handler()
+
+	code, _ := apiRequest(t, handler, http.MethodGet, "/profiles", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, _ = apiRequest(t, handler, http.MethodGet, "/profiles", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, _ = apiRequest(t, handler, http.MethodGet, "/profiles", testToken)
+	assert.Equal(t, http.StatusOK, code)
+
+	// no token configured: nobody is allowed
+	code, _ = apiRequest(t, NewAPIServer("", &mockController{}).Handler(), http.MethodGet, "/profiles", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestAPIProfiles(t *testing.T) {
+	handler := NewAPIServer(testToken, &mockController{}).Handler()
+
+	code, body := apiRequest(t, handler, http.MethodGet, "/profiles", testToken)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `"name": "root"`)
+	assert.Contains(t, body, `"command": "backup"`)
+	assert.Contains(t, body, `"name": "src"`)
+
+	code, body = apiRequest(t, handler, http.MethodGet, "/profiles/root/status", testToken)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `"success": true`)
+
+	code, body = apiRequest(t, handler, http.MethodGet, "/profiles/unknown/status", testToken)
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Contains(t, body, `"error": "profile 'unknown': not found"`)
+
+	code, _ = apiRequest(t, handler, http.MethodDelete, "/profiles", testToken)
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+}
+
+func TestAPIStartAndCancel(t *testing.T) {
+	controller := &mockController{}
+	handler := NewAPIServer(testToken, controller).Handler()
+
+	code, _ := apiRequest(t, handler, http.MethodPost, "/profiles/src/backup", testToken)
+	assert.Equal(t, http.StatusAccepted, code)
+	assert.Equal(t, []string{"src/backup"}, controller.started)
+
+	code, _ = apiRequest(t, handler, http.MethodPost, "/profiles/root/backup", testToken)
+	assert.Equal(t, http.StatusConflict, code)
+
+	code, _ = apiRequest(t, handler, http.MethodPost, "/profiles/src/invalid", testToken)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = apiRequest(t, handler, http.MethodPost, "/profiles/stopped/backup", testToken)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+
+	code, body := apiRequest(t, handler, http.MethodGet, "/jobs", testToken)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `"pid": 123`)
+
+	code, _ = apiRequest(t, handler, http.MethodDelete, "/jobs/root", testToken)
+	assert.Equal(t, http.StatusAccepted, code)
+	assert.Equal(t, []string{"root"}, controller.cancelled)
+
+	code, _ = apiRequest(t, handler, http.MethodDelete, "/jobs/src", testToken)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = apiRequest(t, handler, http.MethodDelete, "/jobs/", testToken)
+	assert.Equal(t, http.StatusNotFound, code)
+}
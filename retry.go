@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"time"
+
+	"github.com/creativeprojects/resticprofile/config"
+	"github.com/creativeprojects/resticprofile/constants"
+)
+
+// retryPolicy decides if and when a failed command should run again
+type retryPolicy struct {
+	maxAttempts   int
+	delay         time.Duration
+	backoffFactor float64
+	maxDelay      time.Duration
+	errorPattern  *regexp.Regexp
+	exitCodes     []int
+}
+
+// newRetryPolicy creates a retry policy from the configuration. It returns nil if the section is nil
+func newRetryPolicy(section *config.RetrySection) (*retryPolicy, error) {
+	if section == nil {
+		return nil, nil
+	}
+	policy := &retryPolicy{
+		maxAttempts:   section.MaxAttempts,
+		delay:         section.Delay,
+		backoffFactor: section.BackoffFactor,
+		maxDelay:      section.MaxDelay,
+		exitCodes:     section.ExitCodes,
+	}
+	if policy.delay <= 0 {
+		policy.delay = constants.DefaultRetryDelay
+	}
+	if policy.backoffFactor == 0 {
+		policy.backoffFactor = constants.DefaultRetryBackoffFactor
+	}
+	if policy.backoffFactor < 1 {
+		return nil, fmt.Errorf("invalid retry backoff-factor %g: it cannot be less than 1", policy.backoffFactor)
+	}
+	if section.ErrorPattern != "" {
+		pattern, err := regexp.Compile(section.ErrorPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retry error-pattern: %w", err)
+		}
+		policy.errorPattern = pattern
+	}
+	return policy, nil
+}
+
+// retryable returns true if the command can run again after the attempt (starting at 1) failed with this error and error output.
+// When neither an error-pattern nor exit-codes are configured, any failure is retryable
+func (p *retryPolicy) retryable(attempt int, err error, errorOutput []byte) bool {
+	if p == nil || attempt >= p.maxAttempts {
+		return false
+	}
+	exitCode := getExitCode(err)
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) && exitCode == -1 {
+		// the command was stopped by a signal: it's not a transient error
+		return false
+	}
+	if p.errorPattern == nil && len(p.exitCodes) == 0 {
+		return true
+	}
+	for _, code := range p.exitCodes {
+		if code == exitCode {
+			return true
+		}
+	}
+	if p.errorPattern != nil && p.errorPattern.Match(errorOutput) {
+		return true
+	}
+	return false
+}
+
+// nextDelay returns the time to wait after the attempt (starting at 1) failed
+func (p *retryPolicy) nextDelay(attempt int) time.Duration {
+	delay := float64(p.delay)
+	for i := 1; i < attempt; i++ {
+		delay *= p.backoffFactor
+		if p.maxDelay > 0 && delay > float64(p.maxDelay) {
+			break
+		}
+	}
+	if p.maxDelay > 0 && delay > float64(p.maxDelay) {
+		return p.maxDelay
+	}
+	return time.Duration(delay)
+}
+
+// outputTail keeps the end of the output of a command
+type outputTail struct {
+	max  int
+	data []byte
+}
+
+func newOutputTail(max int) *outputTail {
+	return &outputTail{max: max}
+}
+
+// Write keeps the last bytes written, up to the maximum size
+func (o *outputTail) Write(p []byte) (int, error) {
+	o.data = append(o.data, p...)
+	if len(o.data) > o.max {
+		o.data = o.data[len(o.data)-o.max:]
+	}
+	return len(p), nil
+}
+
+// Bytes returns the end of the output
+func (o *outputTail) Bytes() []byte {
+	return o.data
+}
+
+// Reset discards the output
+func (o *outputTail) Reset() {
+	o.data = o.data[:0]
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/creativeprojects/resticprofile/config"
+	"github.com/creativeprojects/resticprofile/constants"
+	"github.com/creativeprojects/resticprofile/shell"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func exitWith(t *testing.T, code int) error {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell exit code not available on windows")
+	}
+	err := exec.Command("sh", "-c", "exit "+strconv.Itoa(code)).Run()
+	require.Error(t, err)
+	return err
+}
+
+func TestNewRetryPolicy(t *testing.T) {
+	policy, err := newRetryPolicy(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, policy)
+
+	policy, err = newRetryPolicy(&config.RetrySection{MaxAttempts: 3})
+	require.NoError(t, err)
+	assert.Equal(t, constants.DefaultRetryDelay, policy.delay)
+	assert.Equal(t, constants.DefaultRetryBackoffFactor, policy.backoffFactor)
+
+	_, err = newRetryPolicy(&config.RetrySection{MaxAttempts: 3, BackoffFactor: 0.5})
+	assert.Error(t, err)
+
+	_, err = newRetryPolicy(&config.RetrySection{MaxAttempts: 3, ErrorPattern: "("})
+	assert.Error(t, err)
+}
+
+func TestRetryNextDelay(t *testing.T) {
+	policy := &retryPolicy{delay: 10 * time.Second, backoffFactor: 2}
+	assert.Equal(t, 10*time.Second, policy.nextDelay(1))
+	assert.Equal(t, 20*time.Second, policy.nextDelay(2))
+	assert.Equal(t, 40*time.Second, policy.nextDelay(3))
+
+	policy.maxDelay = 30 * time.Second
+	assert.Equal(t, 30*time.Second, policy.nextDelay(3))
+	assert.Equal(t, 30*time.Second, policy.nextDelay(100))
+
+	policy = &retryPolicy{delay: 10 * time.Second, backoffFactor: 1}
+	assert.Equal(t, 10*time.Second, policy.nextDelay(5))
+}
+
+func TestRetryable(t *testing.T) {
+	exit1 := exitWith(t, 1)
+	exit3 := exitWith(t, 3)
+	networkError := []byte("Fatal: unable to open repository: Get https://s3.example.com: dial tcp: i/o timeout\n")
+
+	var policy *retryPolicy
+	assert.False(t, policy.retryable(1, exit1, nil))
+
+	policy = &retryPolicy{maxAttempts: 3}
+	assert.True(t, policy.retryable(1, exit1, nil))
+	assert.True(t, policy.retryable(2, errors.New("any error"), nil))
+	assert.True(t, policy.retryable(1, &shell.TimeoutError{Timeout: time.Hour}, nil))
+	assert.False(t, policy.retryable(3, exit1, nil))
+
+	policy.exitCodes = []int{3}
+	assert.False(t, policy.retryable(1, exit1, nil))
+	assert.True(t, policy.retryable(1, exit3, nil))
+
+	policy.errorPattern = regexp.MustCompile(`i/o timeout|connection reset`)
+	assert.True(t, policy.retryable(1, exit1, networkError))
+	assert.False(t, policy.retryable(1, exit1, []byte("Fatal: wrong password\n")))
+}
+
+func TestOutputTail(t *testing.T) {
+	tail := newOutputTail(10)
+	_, _ = tail.Write([]byte("0123456789"))
+	_, _ = tail.Write([]byte("abc"))
+	assert.Equal(t, "3456789abc", string(tail.Bytes()))
+	tail.Reset()
+	assert.Empty(t, tail.Bytes())
+}
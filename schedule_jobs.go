@@ -12,7 +12,7 @@ import (
 	"github.com/creativeprojects/resticprofile/schedule"
 )
 
-func scheduleJobs(configFile string, configs []*config.ScheduleConfig) error {
+func scheduleJobs(flags commandLineFlags, configs []*config.ScheduleConfig) error {
 	wd, err := os.Getwd()
 	if err != nil {
 		return err
@@ -29,13 +29,9 @@ func scheduleJobs(configFile string, configs []*config.ScheduleConfig) error {
 	defer schedule.Close()
 
 	for _, scheduleConfig := range configs {
-		args := []string{
-			"--no-ansi",
-			"--config",
-			configFile,
-			"--name",
-			scheduleConfig.Title(),
-		}
+		args := []string{"--no-ansi"}
+		args = append(args, configurationArgs(flags)...)
+		args = append(args, "--name", scheduleConfig.Title())
 		if runtime.GOOS != "darwin" && scheduleConfig.Logfile() != "" {
 			args = append(args, "--log", scheduleConfig.Logfile())
 		}
@@ -43,9 +39,9 @@ func scheduleJobs(configFile string, configs []*config.ScheduleConfig) error {
 
 		scheduleConfig.SetCommand(wd, binary, args)
 		scheduleConfig.SetJobDescription(
-			fmt.Sprintf("resticprofile %s for profile %s in %s", scheduleConfig.SubTitle(), scheduleConfig.Title(), configFile))
+			fmt.Sprintf("resticprofile %s for profile %s in %s", scheduleConfig.SubTitle(), scheduleConfig.Title(), flags.config))
 		scheduleConfig.SetTimerDescription(
-			fmt.Sprintf("%s timer for profile %s in %s", scheduleConfig.SubTitle(), scheduleConfig.Title(), configFile))
+			fmt.Sprintf("%s timer for profile %s in %s", scheduleConfig.SubTitle(), scheduleConfig.Title(), flags.config))
 
 		job := schedule.NewJob(scheduleConfig)
 		err = job.Create()
@@ -0,0 +1,20 @@
+//+build darwin
+
+package secret
+
+import (
+	"bytes"
+	"os/exec"
+)
+
+// readKeyring reads a generic password from the macOS keychain
+func readKeyring(service, account string) (string, error) {
+	stdout := &bytes.Buffer{}
+	cmd := exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w")
+	cmd.Stdout = stdout
+	err := cmd.Run()
+	if err != nil {
+		return "", err
+	}
+	return stdout.String(), nil
+}
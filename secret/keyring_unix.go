@@ -0,0 +1,20 @@
+//+build !darwin,!windows
+
+package secret
+
+import (
+	"bytes"
+	"os/exec"
+)
+
+// readKeyring reads a secret from the Secret Service API (gnome-keyring, kwallet, etc.) via secret-tool
+func readKeyring(service, account string) (string, error) {
+	stdout := &bytes.Buffer{}
+	cmd := exec.Command("secret-tool", "lookup", "service", service, "account", account)
+	cmd.Stdout = stdout
+	err := cmd.Run()
+	if err != nil {
+		return "", err
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,10 @@
+//+build windows
+
+package secret
+
+import "errors"
+
+// readKeyring is not available on Windows yet
+func readKeyring(service, account string) (string, error) {
+	return "", errors.New("keyring is not supported on Windows")
+}
@@ -7,11 +7,29 @@ import (
 	"os/exec"
 	"runtime"
 	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh/terminal"
 )
 
 // SetPID is a callback to send the PID of the current child process
 type SetPID func(pid int)
 
+// isTerminal returns true when the input is a terminal (it can be replaced in unit tests)
+var isTerminal = func(input io.Reader) bool {
+	file, ok := input.(*os.File)
+	return ok && terminal.IsTerminal(int(file.Fd()))
+}
+
+// TimeoutError is returned when the command was stopped because it didn't finish in time
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("command timed out after %s", e.Timeout)
+}
+
 // Command holds the configuration to run a shell command
 type Command struct {
 	Command   string
@@ -22,8 +40,14 @@ type Command struct {
 	Stdout    io.Writer
 	Stderr    io.Writer
 	SetPID    SetPID
-	sigChan   chan os.Signal
-	done      chan interface{}
+	// Timeout is the maximum duration of the command (no limit when zero)
+	Timeout time.Duration
+	// GracePeriod is the time given to the command to stop after the timeout, before it gets killed
+	GracePeriod time.Duration
+	sigChan     chan os.Signal
+	done        chan interface{}
+	// processGroup is true when the child process was started in its own process group
+	processGroup bool
 }
 
 // newCommand instantiate a default Command without receiving OS signals (SIGTERM, etc.)
@@ -65,6 +89,11 @@ func (c *Command) Run() error {
 	if c.Environ != nil && len(c.Environ) > 0 {
 		cmd.Env = append(cmd.Env, c.Environ...)
 	}
+	// the whole process tree needs to be stopped on timeout. But a process outside of the foreground group of
+	// the terminal is stopped (SIGTTIN) when reading from it: an interactive command stays in our group
+	if c.Timeout > 0 && !isTerminal(c.Stdin) && !isTerminal(os.Stdin) {
+		c.setProcessGroup(cmd)
+	}
 
 	// spawn the child process
 	if err = cmd.Start(); err != nil {
@@ -81,9 +110,46 @@ func (c *Command) Run() error {
 		}()
 		go c.propagateSignal(cmd.Process)
 	}
+	if c.Timeout > 0 {
+		finished := make(chan interface{})
+		expired := make(chan bool, 1)
+		go c.watchTimeout(cmd.Process, finished, expired)
+		err = cmd.Wait()
+		close(finished)
+		// a command which exited successfully while it was being stopped has not timed out
+		if <-expired && err != nil {
+			return &TimeoutError{Timeout: c.Timeout}
+		}
+		return err
+	}
 	return cmd.Wait()
 }
 
+// watchTimeout stops the process when the timeout expires: it's asked to terminate first,
+// then it's killed if it's still running after the grace period (a console process on Windows doesn't
+// handle the request to terminate, so the first attempt can fail).
+// It sends true to the expired channel if the timeout expired before the process finished, false otherwise
+func (c *Command) watchTimeout(process *os.Process, finished chan interface{}, expired chan bool) {
+	timer := time.NewTimer(c.Timeout)
+	defer timer.Stop()
+	select {
+	case <-finished:
+		expired <- false
+		return
+	case <-timer.C:
+	}
+	expired <- true
+	_ = c.stopProcess(process, false)
+
+	grace := time.NewTimer(c.GracePeriod)
+	defer grace.Stop()
+	select {
+	case <-finished:
+	case <-grace.C:
+		_ = c.stopProcess(process, true)
+	}
+}
+
 // getShellCommand transforms the command line and arguments to be launched via a shell (sh or cmd.exe)
 func getShellCommand(command string, args []string) (string, []string, error) {
 
@@ -2,6 +2,8 @@ package shell
 
 import (
 	"bytes"
+	"errors"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/signal"
@@ -14,6 +16,13 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+// withTerminal pretends the standard input is (or is not) a terminal, until the returned function is called
+func withTerminal(terminal bool) func() {
+	previous := isTerminal
+	isTerminal = func(io.Reader) bool { return terminal }
+	return func() { isTerminal = previous }
+}
+
 func TestRemoveQuotes(t *testing.T) {
 	source := []string{
 		`-p`,
@@ -154,6 +163,53 @@ func TestInterruptShellCommand(t *testing.T) {
 	assert.WithinDuration(t, time.Now(), start, 1*time.Second)
 }
 
+func TestCommandFinishedBeforeTimeout(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	cmd := newCommand("echo", []string{"TestCommandFinishedBeforeTimeout"})
+	cmd.Stdout = buffer
+	cmd.Timeout = 5 * time.Second
+	err := cmd.Run()
+	assert.NoError(t, err)
+	assert.Contains(t, buffer.String(), "TestCommandFinishedBeforeTimeout")
+}
+
+func TestCommandTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test not running on this platform")
+	}
+	defer withTerminal(false)()
+	buffer := &bytes.Buffer{}
+	// the output is kept open by the child process of the shell
+	cmd := newCommand("sleep 3; echo finished", nil)
+	cmd.Stdout = buffer
+	cmd.Timeout = 100 * time.Millisecond
+	cmd.GracePeriod = time.Second
+
+	start := time.Now()
+	err := cmd.Run()
+	var timeoutErr *TimeoutError
+	assert.True(t, errors.As(err, &timeoutErr))
+	assert.Equal(t, "command timed out after 100ms", err.Error())
+	assert.WithinDuration(t, time.Now(), start, 1*time.Second)
+	assert.NotContains(t, buffer.String(), "finished")
+}
+
+func TestCommandKilledAfterGracePeriod(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test not running on this platform")
+	}
+	defer withTerminal(false)()
+	cmd := newCommand("trap '' TERM; sleep 3", nil)
+	cmd.Timeout = 100 * time.Millisecond
+	cmd.GracePeriod = 200 * time.Millisecond
+
+	start := time.Now()
+	err := cmd.Run()
+	var timeoutErr *TimeoutError
+	assert.True(t, errors.As(err, &timeoutErr))
+	assert.WithinDuration(t, time.Now(), start, 1*time.Second)
+}
+
 func TestSetPIDCallback(t *testing.T) {
 	called := 0
 	buffer := &bytes.Buffer{}
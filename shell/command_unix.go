@@ -4,6 +4,7 @@ package shell
 
 import (
 	"os"
+	"os/exec"
 	"syscall"
 )
 
@@ -11,9 +12,33 @@ func (c *Command) propagateSignal(process *os.Process) {
 	select {
 	case <-c.sigChan:
 		// We resend the signal to the child process
+		if c.processGroup {
+			// the child is not in our process group: send the signal to its whole group
+			syscall.Kill(-process.Pid, syscall.SIGINT)
+			return
+		}
 		process.Signal(syscall.SIGINT)
 		return
 	case <-c.done:
 		return
 	}
 }
+
+// setProcessGroup starts the child process in a new process group
+func (c *Command) setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	c.processGroup = true
+}
+
+// stopProcess sends SIGTERM (or SIGKILL when forced) to the process group of the child process,
+// or only to the child process when it's running in our process group
+func (c *Command) stopProcess(process *os.Process, force bool) error {
+	signal := syscall.SIGTERM
+	if force {
+		signal = syscall.SIGKILL
+	}
+	if !c.processGroup {
+		return syscall.Kill(process.Pid, signal)
+	}
+	return syscall.Kill(-process.Pid, signal)
+}
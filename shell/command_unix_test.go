@@ -0,0 +1,45 @@
+//+build !windows
+
+package shell
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeoutCommandInNewProcessGroup(t *testing.T) {
+	defer withTerminal(false)()
+	pgid := 0
+	cmd := newCommand("sleep 0.2", nil)
+	cmd.Timeout = 5 * time.Second
+	cmd.SetPID = func(pid int) {
+		pgid, _ = syscall.Getpgid(pid)
+	}
+	err := cmd.Run()
+	assert.NoError(t, err)
+	assert.NotEqual(t, syscall.Getpgrp(), pgid)
+}
+
+func TestInteractiveTimeoutCommandInForegroundProcessGroup(t *testing.T) {
+	// the command can read from the terminal without being stopped (SIGTTIN)
+	defer withTerminal(true)()
+	pgid := 0
+	cmd := newCommand("sleep 3", nil)
+	cmd.Timeout = 100 * time.Millisecond
+	cmd.GracePeriod = time.Second
+	cmd.SetPID = func(pid int) {
+		pgid, _ = syscall.Getpgid(pid)
+	}
+
+	start := time.Now()
+	err := cmd.Run()
+	assert.Equal(t, syscall.Getpgrp(), pgid)
+	// the child process is still stopped on timeout
+	var timeoutErr *TimeoutError
+	assert.True(t, errors.As(err, &timeoutErr))
+	assert.WithinDuration(t, time.Now(), start, 2*time.Second)
+}
@@ -2,10 +2,26 @@
 
 package shell
 
-import "os"
+import (
+	"os"
+	"os/exec"
+	"strconv"
+)
 
 // In Windows, all hierarchy will receive the signal (which is good because we cannot send it anyway)
 // In fact, there's nothing for us to do here
 func (c *Command) propagateSignal(*os.Process) {
 	return
 }
+
+// setProcessGroup does nothing: the process tree is stopped using taskkill
+func (c *Command) setProcessGroup(*exec.Cmd) {}
+
+// stopProcess terminates the process tree of the child process (it's forced to terminate when force is true)
+func (c *Command) stopProcess(process *os.Process, force bool) error {
+	args := []string{"/T", "/PID", strconv.Itoa(process.Pid)}
+	if force {
+		args = append([]string{"/F"}, args...)
+	}
+	return exec.Command("taskkill", args...).Run()
+}
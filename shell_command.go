@@ -4,8 +4,10 @@ import (
 	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/creativeprojects/clog"
+	"github.com/creativeprojects/resticprofile/constants"
 	"github.com/creativeprojects/resticprofile/shell"
 )
 
@@ -19,6 +21,7 @@ type shellCommandDefinition struct {
 	dryRun   bool
 	sigChan  chan os.Signal
 	setPID   func(pid int)
+	timeout  time.Duration
 }
 
 // newShellCommand creates a new shell command definition
@@ -57,6 +60,11 @@ func runShellCommand(command shellCommandDefinition) error {
 		shellCmd.Stdin = os.Stdin
 	}
 
+	if command.timeout > 0 {
+		shellCmd.Timeout = command.timeout
+		shellCmd.GracePeriod = constants.DefaultTimeoutGracePeriod
+	}
+
 	// set PID callback
 	if command.setPID != nil {
 		shellCmd.SetPID = command.setPID
@@ -1,16 +1,29 @@
 package status
 
-import "time"
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
 
-// Profile status
+const (
+	commandBackup    = "backup"
+	commandCheck     = "check"
+	commandRetention = "retention"
+)
+
+// Profile status: last status of each command run on the profile.
+//
+// In the status file, the commands are the keys of the profile object
+// (the same format used by the previous "backup", "retention" and "check" fields)
 type Profile struct {
-	Backup    *CommandStatus `json:"backup,omitempty"`
-	Retention *CommandStatus `json:"retention,omitempty"`
-	Check     *CommandStatus `json:"check,omitempty"`
+	Commands map[string]*CommandStatus
 }
 
 func newProfile() *Profile {
-	return &Profile{}
+	return &Profile{
+		Commands: make(map[string]*CommandStatus),
+	}
 }
 
 // CommandStatus is the last command status
@@ -18,48 +31,131 @@ type CommandStatus struct {
 	Success bool      `json:"success"`
 	Time    time.Time `json:"time"`
 	Error   string    `json:"error"`
+	// LastSuccess is the time of the last successful run (kept when the command fails afterwards)
+	LastSuccess time.Time `json:"last-success,omitempty"`
+	// Attempts is the number of times the command ran, when it was retried after a failure
+	Attempts int `json:"attempts,omitempty"`
+}
+
+// GetLastSuccess returns the time of the last successful run, or a zero time if the command never succeeded
+func (c *CommandStatus) GetLastSuccess() time.Time {
+	if c.Success && c.LastSuccess.IsZero() {
+		// status saved before the last-success field was introduced
+		return c.Time
+	}
+	return c.LastSuccess
+}
+
+// Command returns the last status of the command, or nil if the command never ran
+func (p *Profile) Command(command string) *CommandStatus {
+	return p.Commands[command]
+}
+
+// CommandNames returns the names of the commands with a status, sorted alphabetically
+func (p *Profile) CommandNames() []string {
+	names := make([]string, 0, len(p.Commands))
+	for name := range p.Commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CommandSuccess indicates the last run of the command was successful
+func (p *Profile) CommandSuccess(command string) *Profile {
+	p.setCommand(command, newSuccess())
+	return p
+}
+
+// CommandError sets the error of the last run of the command
+func (p *Profile) CommandError(command string, err error) *Profile {
+	p.setCommand(command, newError(err))
+	return p
+}
+
+// CommandAttempts sets the number of attempts of the last run of the command.
+// A single attempt is not saved in the status file
+func (p *Profile) CommandAttempts(command string, attempts int) *Profile {
+	if commandStatus := p.Command(command); commandStatus != nil && attempts > 1 {
+		commandStatus.Attempts = attempts
+	}
+	return p
 }
 
 // BackupSuccess indicates the last backup was successful
 func (p *Profile) BackupSuccess() *Profile {
-	p.Backup = newSuccess()
-	return p
+	return p.CommandSuccess(commandBackup)
 }
 
 // BackupError sets the error of the last backup
 func (p *Profile) BackupError(err error) *Profile {
-	p.Backup = newError(err)
-	return p
+	return p.CommandError(commandBackup, err)
 }
 
 // RetentionSuccess indicates the last retention was successful
 func (p *Profile) RetentionSuccess() *Profile {
-	p.Retention = newSuccess()
-	return p
+	return p.CommandSuccess(commandRetention)
 }
 
 // RetentionError sets the error of the last retention
 func (p *Profile) RetentionError(err error) *Profile {
-	p.Retention = newError(err)
-	return p
+	return p.CommandError(commandRetention, err)
 }
 
 // CheckSuccess indicates the last check was successful
 func (p *Profile) CheckSuccess() *Profile {
-	p.Check = newSuccess()
-	return p
+	return p.CommandSuccess(commandCheck)
 }
 
 // CheckError sets the error of the last check
 func (p *Profile) CheckError(err error) *Profile {
-	p.Check = newError(err)
-	return p
+	return p.CommandError(commandCheck, err)
+}
+
+// MarshalJSON writes the commands as the keys of the profile object
+func (p *Profile) MarshalJSON() ([]byte, error) {
+	commands := p.Commands
+	if commands == nil {
+		commands = make(map[string]*CommandStatus)
+	}
+	return json.Marshal(commands)
+}
+
+// UnmarshalJSON reads the commands from the keys of the profile object
+func (p *Profile) UnmarshalJSON(data []byte) error {
+	commands := make(map[string]*CommandStatus)
+	err := json.Unmarshal(data, &commands)
+	if err != nil {
+		return err
+	}
+	p.Commands = make(map[string]*CommandStatus, len(commands))
+	for name, commandStatus := range commands {
+		// a command saved as null has no status
+		if commandStatus != nil {
+			p.Commands[name] = commandStatus
+		}
+	}
+	return nil
+}
+
+func (p *Profile) setCommand(command string, commandStatus *CommandStatus) {
+	if p.Commands == nil {
+		p.Commands = make(map[string]*CommandStatus)
+	}
+	if !commandStatus.Success {
+		if previous, found := p.Commands[command]; found {
+			commandStatus.LastSuccess = previous.GetLastSuccess()
+		}
+	}
+	p.Commands[command] = commandStatus
 }
 
 func newSuccess() *CommandStatus {
+	now := time.Now()
 	return &CommandStatus{
-		Success: true,
-		Time:    time.Now(),
+		Success:     true,
+		Time:        now,
+		LastSuccess: now,
 	}
 }
 
@@ -2,15 +2,28 @@ package status
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
+	"time"
 
+	"github.com/creativeprojects/resticprofile/lock"
 	"github.com/spf13/afero"
 )
 
+const (
+	// lockTimeout is the maximum time to wait for another process to finish updating the status file
+	lockTimeout = 30 * time.Second
+	// lockRetryDelay is the time to wait before trying to acquire the lock again
+	lockRetryDelay = 50 * time.Millisecond
+)
+
 // Status of last schedule profile
 type Status struct {
 	fs       afero.Fs
 	filename string
+	// lock returns a function releasing the lock on the status file
+	lock     func(filename string) (func(), error)
 	Profiles map[string]*Profile `json:"profiles"`
 }
 
@@ -19,6 +32,7 @@ func NewStatus(fileName string) *Status {
 	return &Status{
 		fs:       afero.NewOsFs(),
 		filename: fileName,
+		lock:     lockFile,
 		Profiles: make(map[string]*Profile),
 	}
 }
@@ -28,6 +42,7 @@ func newAferoStatus(fs afero.Fs, fileName string) *Status {
 	return &Status{
 		fs:       fs,
 		filename: fileName,
+		lock:     func(string) (func(), error) { return func() {}, nil },
 		Profiles: make(map[string]*Profile),
 	}
 }
@@ -55,17 +70,71 @@ func (s *Status) Profile(name string) *Profile {
 	return profile
 }
 
-// Save current status to the file
+// Save current status to the file.
+// The status is written into a temporary file first, which then replaces the status file:
+// a process reading the status file never sees a half-written file.
 func (s *Status) Save() error {
-	file, err := s.fs.OpenFile(s.filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	dir, name := filepath.Split(s.filename)
+	if dir == "" {
+		dir = "."
+	}
+	file, err := afero.TempFile(s.fs, dir, name+".*.tmp")
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	tempFile := file.Name()
 	encoder := json.NewEncoder(file)
 	err = encoder.Encode(s)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = s.fs.Chmod(tempFile, 0644)
+	}
+	if err == nil {
+		err = s.fs.Rename(tempFile, s.filename)
+	}
 	if err != nil {
+		_ = s.fs.Remove(tempFile)
 		return err
 	}
 	return nil
 }
+
+// Update loads the latest status from the file, applies the changes and saves it back.
+// The status file is locked during the update, so another process sharing the same status file
+// cannot overwrite the changes.
+func (s *Status) Update(update func(status *Status)) error {
+	release, err := s.lock(s.filename)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// always start from the latest version of the file
+	s.Profiles = make(map[string]*Profile)
+	s.Load()
+	update(s)
+	return s.Save()
+}
+
+// lockFile acquires the lock on the status file, waiting until lockTimeout if another process is holding it
+func lockFile(filename string) (func(), error) {
+	statusLock := lock.NewLock(filename + ".lock")
+	deadline := time.Now().Add(lockTimeout)
+	// a lock left by a process which is no longer running is removed, but only on the first attempt:
+	// after that, the lock file can belong to another process which has just removed the same stale lock
+	acquired := statusLock.ForceAcquire()
+	for !acquired {
+		if time.Now().After(deadline) {
+			who, _ := statusLock.Who()
+			return nil, fmt.Errorf("timeout waiting for the lock on status file '%s' held by %s", filename, who)
+		}
+		time.Sleep(lockRetryDelay)
+		acquired = statusLock.TryAcquire()
+	}
+	// the PID allows to detect a stale lock if this process dies before releasing it
+	statusLock.SetPID(os.Getpid())
+	return statusLock.Release, nil
+}
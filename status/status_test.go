@@ -1,11 +1,19 @@
 package status
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLoadNoFile(t *testing.T) {
@@ -18,58 +26,58 @@ func TestLoadNoFile(t *testing.T) {
 func TestBackupSuccess(t *testing.T) {
 	profileName := "test profile"
 	status := NewStatus("")
-	assert.Nil(t, status.Profile(profileName).Backup)
+	assert.Nil(t, status.Profile(profileName).Command("backup"))
 	status.Profile(profileName).BackupSuccess()
-	assert.True(t, status.Profile(profileName).Backup.Success)
-	assert.Empty(t, status.Profile(profileName).Backup.Error)
+	assert.True(t, status.Profile(profileName).Command("backup").Success)
+	assert.Empty(t, status.Profile(profileName).Command("backup").Error)
 }
 
 func TestBackupError(t *testing.T) {
 	errorMessage := "test test test"
 	profileName := "test profile"
 	status := NewStatus("")
-	assert.Nil(t, status.Profile(profileName).Backup)
+	assert.Nil(t, status.Profile(profileName).Command("backup"))
 	status.Profile(profileName).BackupError(errors.New(errorMessage))
-	assert.False(t, status.Profile(profileName).Backup.Success)
-	assert.Equal(t, errorMessage, status.Profile(profileName).Backup.Error)
+	assert.False(t, status.Profile(profileName).Command("backup").Success)
+	assert.Equal(t, errorMessage, status.Profile(profileName).Command("backup").Error)
 }
 
 func TestRetentionSuccess(t *testing.T) {
 	profileName := "test profile"
 	status := NewStatus("")
-	assert.Nil(t, status.Profile(profileName).Retention)
+	assert.Nil(t, status.Profile(profileName).Command("retention"))
 	status.Profile(profileName).RetentionSuccess()
-	assert.True(t, status.Profile(profileName).Retention.Success)
-	assert.Empty(t, status.Profile(profileName).Retention.Error)
+	assert.True(t, status.Profile(profileName).Command("retention").Success)
+	assert.Empty(t, status.Profile(profileName).Command("retention").Error)
 }
 
 func TestRetentionError(t *testing.T) {
 	errorMessage := "test test test"
 	profileName := "test profile"
 	status := NewStatus("")
-	assert.Nil(t, status.Profile(profileName).Retention)
+	assert.Nil(t, status.Profile(profileName).Command("retention"))
 	status.Profile(profileName).RetentionError(errors.New(errorMessage))
-	assert.False(t, status.Profile(profileName).Retention.Success)
-	assert.Equal(t, errorMessage, status.Profile(profileName).Retention.Error)
+	assert.False(t, status.Profile(profileName).Command("retention").Success)
+	assert.Equal(t, errorMessage, status.Profile(profileName).Command("retention").Error)
 }
 
 func TestCheckSuccess(t *testing.T) {
 	profileName := "test profile"
 	status := NewStatus("")
-	assert.Nil(t, status.Profile(profileName).Check)
+	assert.Nil(t, status.Profile(profileName).Command("check"))
 	status.Profile(profileName).CheckSuccess()
-	assert.True(t, status.Profile(profileName).Check.Success)
-	assert.Empty(t, status.Profile(profileName).Check.Error)
+	assert.True(t, status.Profile(profileName).Command("check").Success)
+	assert.Empty(t, status.Profile(profileName).Command("check").Error)
 }
 
 func TestCheckError(t *testing.T) {
 	errorMessage := "test test test"
 	profileName := "test profile"
 	status := NewStatus("")
-	assert.Nil(t, status.Profile(profileName).Check)
+	assert.Nil(t, status.Profile(profileName).Command("check"))
 	status.Profile(profileName).CheckError(errors.New(errorMessage))
-	assert.False(t, status.Profile(profileName).Check.Success)
-	assert.Equal(t, errorMessage, status.Profile(profileName).Check.Error)
+	assert.False(t, status.Profile(profileName).Command("check").Success)
+	assert.Equal(t, errorMessage, status.Profile(profileName).Command("check").Error)
 }
 
 func TestSaveAndLoadEmptyStatus(t *testing.T) {
@@ -99,10 +107,10 @@ func TestSaveAndLoadBackupSuccess(t *testing.T) {
 	assert.NoError(t, err)
 
 	status = newAferoStatus(fs, filename).Load()
-	assert.NotNil(t, status.Profile(profileName).Backup)
-	assert.Nil(t, status.Profile(profileName).Retention)
-	assert.Nil(t, status.Profile(profileName).Check)
-	assert.True(t, status.Profile(profileName).Backup.Success)
+	assert.NotNil(t, status.Profile(profileName).Command("backup"))
+	assert.Nil(t, status.Profile(profileName).Command("retention"))
+	assert.Nil(t, status.Profile(profileName).Command("check"))
+	assert.True(t, status.Profile(profileName).Command("backup").Success)
 }
 
 func TestSaveAndLoadBackupError(t *testing.T) {
@@ -117,11 +125,11 @@ func TestSaveAndLoadBackupError(t *testing.T) {
 	assert.NoError(t, err)
 
 	status = newAferoStatus(fs, filename).Load()
-	assert.NotNil(t, status.Profile(profileName).Backup)
-	assert.Nil(t, status.Profile(profileName).Retention)
-	assert.Nil(t, status.Profile(profileName).Check)
-	assert.False(t, status.Profile(profileName).Backup.Success)
-	assert.Equal(t, errorMessage, status.Profile(profileName).Backup.Error)
+	assert.NotNil(t, status.Profile(profileName).Command("backup"))
+	assert.Nil(t, status.Profile(profileName).Command("retention"))
+	assert.Nil(t, status.Profile(profileName).Command("check"))
+	assert.False(t, status.Profile(profileName).Command("backup").Success)
+	assert.Equal(t, errorMessage, status.Profile(profileName).Command("backup").Error)
 }
 
 func TestAddToExistingProfile(t *testing.T) {
@@ -141,9 +149,9 @@ func TestAddToExistingProfile(t *testing.T) {
 
 	status = newAferoStatus(fs, filename).Load()
 	profile := status.Profile(profileName)
-	assert.True(t, profile.Backup.Success)
-	assert.True(t, profile.Check.Success)
-	assert.Nil(t, profile.Retention)
+	assert.True(t, profile.Command("backup").Success)
+	assert.True(t, profile.Command("check").Success)
+	assert.Nil(t, profile.Command("retention"))
 }
 
 func TestAddProfile(t *testing.T) {
@@ -164,14 +172,14 @@ func TestAddProfile(t *testing.T) {
 
 	status = newAferoStatus(fs, filename).Load()
 	profile := status.Profile(profile1)
-	assert.True(t, profile.Backup.Success)
-	assert.Nil(t, profile.Check)
-	assert.Nil(t, profile.Retention)
+	assert.True(t, profile.Command("backup").Success)
+	assert.Nil(t, profile.Command("check"))
+	assert.Nil(t, profile.Command("retention"))
 
 	profile = status.Profile(profile2)
-	assert.Nil(t, profile.Backup)
-	assert.True(t, profile.Check.Success)
-	assert.Nil(t, profile.Retention)
+	assert.Nil(t, profile.Command("backup"))
+	assert.True(t, profile.Command("check").Success)
+	assert.Nil(t, profile.Command("retention"))
 }
 
 func TestAddSuccessAfterError(t *testing.T) {
@@ -191,6 +199,203 @@ func TestAddSuccessAfterError(t *testing.T) {
 
 	status = newAferoStatus(fs, filename).Load()
 	profile := status.Profile(profileName)
-	assert.True(t, profile.Backup.Success)
-	assert.Empty(t, profile.Backup.Error)
+	assert.True(t, profile.Command("backup").Success)
+	assert.Empty(t, profile.Command("backup").Error)
+}
+
+func TestSaveReplacesFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resticprofile-status")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "status.json")
+
+	err = ioutil.WriteFile(filename, []byte(`{"profiles":{"other":{}}, "some garbage after a previous write"`), 0644)
+	require.NoError(t, err)
+
+	status := NewStatus(filename)
+	status.Profile("test profile").BackupSuccess()
+	err = status.Save()
+	require.NoError(t, err)
+
+	content, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+	assert.True(t, json.Valid(content))
+
+	// no temporary file left behind
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestConcurrentUpdates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resticprofile-status")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "status.json")
+
+	const writers = 20
+	wg := sync.WaitGroup{}
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := NewStatus(filename).Update(func(status *Status) {
+				status.Profile(fmt.Sprintf("profile %d", i)).BackupSuccess()
+			})
+			assert.NoError(t, err)
+			// reading the file at any time should give a valid status
+			content, err := ioutil.ReadFile(filename)
+			assert.NoError(t, err)
+			assert.True(t, json.Valid(content))
+		}(i)
+	}
+	wg.Wait()
+
+	status := NewStatus(filename).Load()
+	assert.Len(t, status.Profiles, writers)
+	for i := 0; i < writers; i++ {
+		profile := status.Profiles[fmt.Sprintf("profile %d", i)]
+		require.NotNil(t, profile)
+		assert.True(t, profile.Command("backup").Success)
+	}
+
+	// the lock has been released
+	assert.NoFileExists(t, filename+".lock")
+}
+
+func TestUpdateWithStaleLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resticprofile-status")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "status.json")
+
+	// lock left behind by a process which is no longer running
+	err = ioutil.WriteFile(filename+".lock", []byte("someone\n999999999"), 0644)
+	require.NoError(t, err)
+
+	err = NewStatus(filename).Update(func(status *Status) {
+		status.Profile("test profile").CheckSuccess()
+	})
+	require.NoError(t, err)
+	assert.True(t, NewStatus(filename).Load().Profile("test profile").Command("check").Success)
+}
+
+func TestConcurrentUpdatesWithStaleLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resticprofile-status")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "status.json")
+
+	err = ioutil.WriteFile(filename+".lock", []byte("someone\n999999999"), 0644)
+	require.NoError(t, err)
+
+	const updates = 10
+	wg := sync.WaitGroup{}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < updates; j++ {
+				err := NewStatus(filename).Update(func(status *Status) {
+					status.Profile(fmt.Sprintf("profile %d-%d", i, j)).BackupSuccess()
+				})
+				assert.NoError(t, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// no update was lost
+	status := NewStatus(filename).Load()
+	assert.Len(t, status.Profiles, 2*updates)
+	assert.NoFileExists(t, filename+".lock")
+}
+
+func TestLoadPreviousFormat(t *testing.T) {
+	filename := "TestLoadPreviousFormat.json"
+	fs := afero.NewMemMapFs()
+	err := afero.WriteFile(fs, filename, []byte(`{
+  "profiles": {
+    "my-backup": {
+      "backup": {
+        "success": true,
+        "time": "2020-07-31T23:54:00.401556+01:00",
+        "error": ""
+      },
+      "retention": null,
+      "check": {
+        "success": false,
+        "time": "2020-07-31T23:47:22.311848+01:00",
+        "error": "exit status 1"
+      }
+    }
+  }
+}`), 0644)
+	require.NoError(t, err)
+
+	status := newAferoStatus(fs, filename).Load()
+	profile := status.Profile("my-backup")
+	assert.Equal(t, []string{"backup", "check"}, profile.CommandNames())
+	assert.True(t, profile.Command("backup").Success)
+	assert.False(t, profile.Command("check").Success)
+	assert.Equal(t, "exit status 1", profile.Command("check").Error)
+	assert.Nil(t, profile.Command("retention"))
+}
+
+func TestSaveAndLoadAnyCommand(t *testing.T) {
+	filename := "TestSaveAndLoadAnyCommand.json"
+	profileName := "test profile"
+
+	fs := afero.NewMemMapFs()
+	status := newAferoStatus(fs, filename).Load()
+	status.Profile(profileName).CommandSuccess("prune")
+	status.Profile(profileName).CommandError("copy", errors.New("no repository"))
+	err := status.Save()
+	require.NoError(t, err)
+
+	content, err := afero.ReadFile(fs, filename)
+	require.NoError(t, err)
+	decoded := map[string]map[string]map[string]interface{}{}
+	err = json.Unmarshal(content, &decoded)
+	require.NoError(t, err)
+	assert.Contains(t, decoded["profiles"][profileName], "prune")
+	assert.Contains(t, decoded["profiles"][profileName], "copy")
+
+	status = newAferoStatus(fs, filename).Load()
+	profile := status.Profile(profileName)
+	assert.Equal(t, []string{"copy", "prune"}, profile.CommandNames())
+	assert.True(t, profile.Command("prune").Success)
+	assert.False(t, profile.Command("copy").Success)
+	assert.Equal(t, "no repository", profile.Command("copy").Error)
+}
+
+func TestEmptyProfileToJSON(t *testing.T) {
+	content, err := json.Marshal(&Profile{})
+	require.NoError(t, err)
+	assert.Equal(t, "{}", string(content))
+}
+
+func TestLastSuccessKeptAfterError(t *testing.T) {
+	profile := newProfile()
+	assert.Nil(t, profile.Command("backup"))
+
+	profile.BackupError(errors.New("first error"))
+	assert.True(t, profile.Command("backup").GetLastSuccess().IsZero())
+
+	profile.BackupSuccess()
+	lastSuccess := profile.Command("backup").GetLastSuccess()
+	assert.False(t, lastSuccess.IsZero())
+
+	profile.BackupError(errors.New("second error"))
+	assert.False(t, profile.Command("backup").Success)
+	assert.Equal(t, lastSuccess, profile.Command("backup").GetLastSuccess())
+}
+
+func TestLastSuccessFromPreviousFormat(t *testing.T) {
+	successTime := time.Date(2020, 7, 31, 23, 54, 0, 0, time.UTC)
+	commandStatus := &CommandStatus{Success: true, Time: successTime}
+	assert.Equal(t, successTime, commandStatus.GetLastSuccess())
+
+	commandStatus = &CommandStatus{Success: false, Time: successTime}
+	assert.True(t, commandStatus.GetLastSuccess().IsZero())
 }
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/creativeprojects/clog"
+	"github.com/creativeprojects/resticprofile/calendar"
+	"github.com/creativeprojects/resticprofile/config"
+	"github.com/creativeprojects/resticprofile/constants"
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/pflag"
+)
+
+// watchConfiguration keeps the scheduled jobs in sync with the configuration file: every time the file is saved,
+// the jobs of the profiles with a different schedule configuration are created again (or removed)
+func watchConfiguration(c *config.Config, flags commandLineFlags, args []string) error {
+	delay := constants.DefaultWatchDelay
+	flagset := pflag.NewFlagSet("watch", pflag.ContinueOnError)
+	flagset.DurationVar(&delay, "delay", constants.DefaultWatchDelay, "wait for this long after the last change before reloading the configuration")
+	err := flagset.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.config == constants.ConfigurationStdin || isURL(flags.config) {
+		return errors.New("the watch command needs a configuration file")
+	}
+
+	// load the same file again, even if it was found in another directory
+	flags.config = c.GetConfigFile()
+	configFile, err := filepath.Abs(flags.config)
+	if err != nil {
+		return err
+	}
+
+	current, err := loadSchedules(c)
+	if err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	// editors often save a new file and rename it: watching the directory catches all of these events
+	err = watcher.Add(filepath.Dir(configFile))
+	if err != nil {
+		return err
+	}
+	clog.Infof("watching configuration file %s (%d scheduled jobs)", configFile, len(current))
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+
+	// a single save can send a few events: wait until the file is quiet
+	reload := time.NewTimer(delay)
+	reload.Stop()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Clean(event.Name) != configFile || event.Op&fsnotify.Chmod == event.Op {
+				continue
+			}
+			clog.Debugf("configuration file event: %s", event.Op)
+			reload.Reset(delay)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			clog.Warningf("watching configuration file: %v", err)
+
+		case <-reload.C:
+			current = rescheduleJobs(flags, current)
+
+		case <-sigChan:
+			clog.Info("stopped watching configuration file")
+			return nil
+		}
+	}
+}
+
+// rescheduleJobs loads the configuration again, and updates the jobs that have changed.
+// It returns the jobs currently scheduled
+func rescheduleJobs(flags commandLineFlags, current map[string]*config.ScheduleConfig) map[string]*config.ScheduleConfig {
+	c, err := loadConfiguration(flags)
+	if err != nil {
+		clog.Errorf("cannot load configuration: %v", err)
+		return current
+	}
+	c.AddEnvironmentOverrides(os.Environ())
+	// the flags were already validated when starting
+	_ = c.AddCommandLineOverrides(flags.set)
+
+	schedules, err := loadSchedules(c)
+	if err != nil {
+		clog.Errorf("invalid configuration, keeping the current scheduled jobs: %v", err)
+		return current
+	}
+
+	removed, created := diffSchedules(current, schedules)
+	if len(removed) == 0 && len(created) == 0 {
+		clog.Info("configuration reloaded: no change in the scheduled jobs")
+		return current
+	}
+
+	scheduled := make(map[string]*config.ScheduleConfig, len(current))
+	for key, scheduleConfig := range current {
+		scheduled[key] = scheduleConfig
+	}
+	for _, scheduleConfig := range removed {
+		err = removeJobs([]*config.ScheduleConfig{scheduleConfig})
+		if err != nil {
+			clog.Error(err)
+			continue
+		}
+		delete(scheduled, scheduleKey(scheduleConfig))
+	}
+	for _, scheduleConfig := range created {
+		key := scheduleKey(scheduleConfig)
+		if _, found := scheduled[key]; found {
+			// the previous job could not be removed
+			continue
+		}
+		err = scheduleJobs(flags, []*config.ScheduleConfig{scheduleConfig})
+		if err != nil {
+			clog.Error(err)
+			continue
+		}
+		scheduled[key] = scheduleConfig
+	}
+	return scheduled
+}
+
+// loadSchedules returns the schedule configuration of all the profiles, indexed by profile and command.
+// It returns an error if any profile cannot be loaded or contains an invalid schedule
+func loadSchedules(c *config.Config) (map[string]*config.ScheduleConfig, error) {
+	schedules := make(map[string]*config.ScheduleConfig)
+	for profileName := range c.GetProfileSections() {
+		profile, err := c.GetProfile(profileName, "schedule")
+		if err != nil {
+			return nil, fmt.Errorf("cannot load profile '%s': %w", profileName, err)
+		}
+		if profile == nil {
+			continue
+		}
+		for _, scheduleConfig := range profile.Schedules() {
+			for _, schedule := range scheduleConfig.Schedules() {
+				err = calendar.NewEvent().Parse(schedule)
+				if err != nil {
+					return nil, fmt.Errorf("invalid schedule '%s' for %s/%s: %w", schedule, profileName, scheduleConfig.SubTitle(), err)
+				}
+			}
+			schedules[scheduleKey(scheduleConfig)] = scheduleConfig
+		}
+	}
+	return schedules, nil
+}
+
+// diffSchedules returns the jobs to remove and the jobs to create to go from the previous to the current configuration.
+// A job with a different configuration is in both lists
+func diffSchedules(previous, current map[string]*config.ScheduleConfig) (removed, created []*config.ScheduleConfig) {
+	for _, key := range sortedScheduleKeys(previous) {
+		if currentConfig, found := current[key]; !found || !previous[key].Equal(currentConfig) {
+			removed = append(removed, previous[key])
+		}
+	}
+	for _, key := range sortedScheduleKeys(current) {
+		if previousConfig, found := previous[key]; !found || !current[key].Equal(previousConfig) {
+			created = append(created, current[key])
+		}
+	}
+	return
+}
+
+func scheduleKey(scheduleConfig *config.ScheduleConfig) string {
+	return scheduleConfig.Title() + "/" + scheduleConfig.SubTitle()
+}
+
+func sortedScheduleKeys(schedules map[string]*config.ScheduleConfig) []string {
+	keys := make([]string, 0, len(schedules))
+	for key := range schedules {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
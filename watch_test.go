@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/creativeprojects/resticprofile/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadTestSchedules(t *testing.T, configuration string) map[string]*config.ScheduleConfig {
+	c, err := config.Load(bytes.NewBufferString(configuration), "toml")
+	require.NoError(t, err)
+	schedules, err := loadSchedules(c)
+	require.NoError(t, err)
+	return schedules
+}
+
+func TestLoadSchedules(t *testing.T) {
+	schedules := loadTestSchedules(t, `
+[groups]
+full = ["root", "home"]
+
+[root.backup]
+schedule = "daily"
+
+[root.check]
+schedule = ["weekly", "monthly"]
+
+[home.backup]
+source = "/home"
+`)
+	assert.Equal(t, []string{"root/backup", "root/check"}, sortedScheduleKeys(schedules))
+}
+
+func TestLoadInvalidSchedule(t *testing.T) {
+	c, err := config.Load(bytes.NewBufferString(`
+[root.backup]
+schedule = "every other day"
+`), "toml")
+	require.NoError(t, err)
+	_, err = loadSchedules(c)
+	assert.Error(t, err)
+}
+
+func TestDiffSchedules(t *testing.T) {
+	previous := loadTestSchedules(t, `
+[root.backup]
+schedule = "daily"
+
+[root.check]
+schedule = "weekly"
+
+[home.backup]
+schedule = "hourly"
+
+[home.check]
+schedule = "monthly"
+`)
+	current := loadTestSchedules(t, `
+[root.backup]
+schedule = "daily"
+
+[root.check]
+schedule = "weekly"
+schedule-permission = "system"
+
+[home.backup]
+schedule = "hourly"
+
+[home.retention]
+schedule = "daily"
+`)
+	removed, created := diffSchedules(previous, current)
+
+	removedKeys := make([]string, len(removed))
+	for i, scheduleConfig := range removed {
+		removedKeys[i] = scheduleKey(scheduleConfig)
+	}
+	createdKeys := make([]string, len(created))
+	for i, scheduleConfig := range created {
+		createdKeys[i] = scheduleKey(scheduleConfig)
+	}
+	assert.Equal(t, []string{"home/check", "root/check"}, removedKeys)
+	assert.Equal(t, []string{"home/retention", "root/check"}, createdKeys)
+	assert.Equal(t, "system", created[1].Permission())
+}
+
+func TestDiffSameSchedules(t *testing.T) {
+	configuration := `
+[root.backup]
+schedule = "daily"
+`
+	removed, created := diffSchedules(loadTestSchedules(t, configuration), loadTestSchedules(t, configuration))
+	assert.Empty(t, removed)
+	assert.Empty(t, created)
+}
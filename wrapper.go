@@ -1,20 +1,37 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/creativeprojects/clog"
 	"github.com/creativeprojects/resticprofile/config"
 	"github.com/creativeprojects/resticprofile/constants"
+	"github.com/creativeprojects/resticprofile/dotenv"
+	"github.com/creativeprojects/resticprofile/history"
 	"github.com/creativeprojects/resticprofile/lock"
+	"github.com/creativeprojects/resticprofile/secret"
 	"github.com/creativeprojects/resticprofile/status"
 	"github.com/creativeprojects/resticprofile/term"
 )
 
+const (
+	// maxErrorOutput is the size of the end of the error output of restic kept in memory:
+	// to match the error pattern of a retry, and to send to the run-* commands
+	maxErrorOutput = 64 * 1024
+	// maxErrorOutputEnvironment is the size of the end of the error output sent to the run-* commands
+	maxErrorOutputEnvironment = 4 * 1024
+)
+
 type resticWrapper struct {
 	resticBinary string
 	initialize   bool
@@ -24,6 +41,13 @@ type resticWrapper struct {
 	moreArgs     []string
 	sigChan      chan os.Signal
 	setPID       func(pid int)
+	envFiles     map[string]string
+	secrets      map[string]string
+	explain      func(step string, command shellCommandDefinition)
+	summary      *history.SummaryWriter
+	start        time.Time
+	exitCode     int
+	errorOutput  *outputTail
 }
 
 func newResticWrapper(
@@ -43,101 +67,139 @@ func newResticWrapper(
 		command:      command,
 		moreArgs:     moreArgs,
 		sigChan:      c,
+		exitCode:     -1,
+		errorOutput:  newOutputTail(maxErrorOutput),
 	}
 }
 
 func (r *resticWrapper) runProfile() error {
+	// the secrets are resolved again on the next run (they might have changed in the meantime)
+	defer secret.ClearCache()
+
+	start := time.Now()
+	r.start = start
 	err := lockRun(r.profile.Lock, r.profile.ForceLock, func(setPID lock.SetPID) error {
 		r.setPID = setPID
-		return runOnFailure(
+		err := runOnFailure(
 			func() error {
 				var err error
 
-				// pre-profile commands
-				err = r.runProfilePreCommand()
+				// environment files are loaded first: they're needed by all the commands
+				err = r.loadEnvironmentFiles()
 				if err != nil {
 					return err
 				}
-
-				// breaking change from 0.7.0 and 0.7.1:
-				// run the initialization after the pre-profile commands
-				if r.initialize && r.command != constants.CommandInit {
-					_ = r.runInitialize()
-					// it's ok for the initialize to error out when the repository exists
-				}
-
-				// pre-commands (for backup)
-				if r.command == constants.CommandBackup {
-					// Shell commands
-					err = r.runPreCommand(r.command)
-					if err != nil {
-						return err
-					}
-					// Check
-					if r.profile.Backup != nil && r.profile.Backup.CheckBefore {
-						err = r.runCheck()
-						if err != nil {
-							return err
-						}
-					}
-					// Retention
-					if r.profile.Retention != nil && r.profile.Retention.BeforeBackup {
-						err = r.runRetention()
-						if err != nil {
-							return err
-						}
-					}
-				}
-
-				// Main command
-				err = r.runCommand(r.command)
-				if err != nil {
-					return err
-				}
-
-				// post-commands (for backup)
-				if r.command == constants.CommandBackup {
-					// Retention
-					if r.profile.Retention != nil && r.profile.Retention.AfterBackup {
-						err = r.runRetention()
-						if err != nil {
-							return err
-						}
-					}
-					// Check
-					if r.profile.Backup != nil && r.profile.Backup.CheckAfter {
-						err = r.runCheck()
-						if err != nil {
-							return err
-						}
-					}
-					// Shell commands
-					err = r.runPostCommand(r.command)
-					if err != nil {
-						return err
-					}
-				}
-
-				// post-profile commands
-				err = r.runProfilePostCommand()
+				err = r.resolveSecrets()
 				if err != nil {
 					return err
 				}
 
-				return nil
+				return r.runSteps()
 			},
 			// on failure
 			func(err error) {
+				_ = r.runPostFailCommand(r.command, err)
 				_ = r.runProfilePostFailCommand(err)
 			},
 		)
+		// the run-finally commands are running whatever the result
+		finallyErr := r.runFinallyCommand(r.command, err)
+		profileFinallyErr := r.runProfileFinallyCommand(err)
+		if err != nil {
+			return err
+		}
+		if finallyErr != nil {
+			return finallyErr
+		}
+		return profileFinallyErr
 	})
+	r.saveHistory(start, time.Now(), err)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// runSteps runs all the commands of the profile in order
+func (r *resticWrapper) runSteps() error {
+	var err error
+
+	// pre-profile commands
+	err = r.runProfilePreCommand()
+	if err != nil {
+		return err
+	}
+
+	// breaking change from 0.7.0 and 0.7.1:
+	// run the initialization after the pre-profile commands
+	if r.initialize && r.command != constants.CommandInit {
+		_ = r.runInitialize()
+		// it's ok for the initialize to error out when the repository exists
+	}
+
+	// pre-commands
+	err = r.runPreCommand(r.command)
+	if err != nil {
+		return err
+	}
+
+	// check and retention before a backup
+	if r.command == constants.CommandBackup {
+		// Check
+		if r.profile.Backup != nil && r.profile.Backup.CheckBefore {
+			err = r.runCheck()
+			if err != nil {
+				return err
+			}
+		}
+		// Retention
+		if r.profile.Retention != nil && r.profile.Retention.BeforeBackup {
+			err = r.runRetention()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Main command
+	err = r.runCommand(r.command)
+	if err != nil {
+		return err
+	}
+
+	// retention and check after a backup
+	if r.command == constants.CommandBackup {
+		// Retention
+		if r.profile.Retention != nil && r.profile.Retention.AfterBackup {
+			err = r.runRetention()
+			if err != nil {
+				return err
+			}
+		}
+		// Check
+		if r.profile.Backup != nil && r.profile.Backup.CheckAfter {
+			err = r.runCheck()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// post-commands
+	err = r.runPostCommand(r.command)
+	if err != nil {
+		return err
+	}
+
+	// post-profile commands
+	err = r.runProfilePostCommand()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (r *resticWrapper) prepareCommand(command string, args []string) shellCommandDefinition {
 	// place the restic command first, there are some flags not recognized otherwise (like --stdin)
 	arguments := append([]string{command}, args...)
@@ -151,10 +213,12 @@ func (r *resticWrapper) prepareCommand(command string, args []string) shellComma
 		arguments = append(arguments, r.profile.GetBackupSource()...)
 	}
 
-	env := append(os.Environ(), r.getEnvironment()...)
+	// the environment of the current process is added when running the command
+	env := r.getEnvironment()
 
 	clog.Debugf("starting command: %s %s", r.resticBinary, strings.Join(arguments, " "))
 	rCommand := newShellCommand(r.resticBinary, arguments, env, r.dryRun, r.sigChan, r.setPID)
+	rCommand.timeout = r.profile.GetTimeout(command)
 	// stdout are stderr are coming from the default terminal (in case they're redirected)
 	rCommand.stdout = term.GetOutput()
 	rCommand.stderr = term.GetErrorOutput()
@@ -167,12 +231,12 @@ func (r *resticWrapper) prepareCommand(command string, args []string) shellComma
 }
 
 func (r *resticWrapper) runInitialize() error {
-	clog.Infof("profile '%s': initializing repository (if not existing)", r.profile.Name)
+	r.progressf("profile '%s': initializing repository (if not existing)", r.profile.Name)
 	args := convertIntoArgs(r.profile.GetCommandFlags(constants.CommandInit))
 	rCommand := r.prepareCommand(constants.CommandInit, args)
 	// don't display any error
 	rCommand.stderr = nil
-	err := runShellCommand(rCommand)
+	err := r.runStep(constants.CommandInit, rCommand)
 	if err != nil {
 		return fmt.Errorf("repository initialization on profile '%s': %w", r.profile.Name, err)
 	}
@@ -180,90 +244,214 @@ func (r *resticWrapper) runInitialize() error {
 }
 
 func (r *resticWrapper) runCheck() error {
-	clog.Infof("profile '%s': checking repository consistency", r.profile.Name)
+	r.progressf("profile '%s': checking repository consistency", r.profile.Name)
 	args := convertIntoArgs(r.profile.GetCommandFlags(constants.CommandCheck))
-	rCommand := r.prepareCommand(constants.CommandCheck, args)
-	err := runShellCommand(rCommand)
+	err := r.runStepWithRetry(constants.CommandCheck, func() shellCommandDefinition {
+		return r.prepareCommand(constants.CommandCheck, args)
+	})
 	if err != nil {
-		r.statusError(constants.CommandCheck, err)
 		return fmt.Errorf("backup check on profile '%s': %w", r.profile.Name, err)
 	}
-	r.statusSuccess(constants.CommandCheck)
 	return nil
 }
 
 func (r *resticWrapper) runRetention() error {
-	clog.Infof("profile '%s': cleaning up repository using retention information", r.profile.Name)
+	r.progressf("profile '%s': cleaning up repository using retention information", r.profile.Name)
 	args := convertIntoArgs(r.profile.GetRetentionFlags())
-	rCommand := r.prepareCommand(constants.CommandForget, args)
-	err := runShellCommand(rCommand)
+	err := r.runStepWithRetry(constants.SectionConfigurationRetention, func() shellCommandDefinition {
+		rCommand := r.prepareCommand(constants.CommandForget, args)
+		// the timeout of the retention section, instead of the one from the forget section
+		rCommand.timeout = r.profile.GetTimeout(constants.SectionConfigurationRetention)
+		return rCommand
+	})
 	if err != nil {
-		r.statusError(constants.SectionConfigurationRetention, err)
 		return fmt.Errorf("backup retention on profile '%s': %w", r.profile.Name, err)
 	}
-	r.statusSuccess(constants.SectionConfigurationRetention)
 	return nil
 }
 
 func (r *resticWrapper) runCommand(command string) error {
-	clog.Infof("profile '%s': starting '%s'", r.profile.Name, command)
+	r.progressf("profile '%s': starting '%s'", r.profile.Name, command)
 	args := convertIntoArgs(r.profile.GetCommandFlags(command))
-	rCommand := r.prepareCommand(command, args)
-	err := runShellCommand(rCommand)
+	err := r.runStepWithRetry(command, func() shellCommandDefinition {
+		rCommand := r.prepareCommand(command, args)
+		// keep a copy of the output to extract the summary of the run
+		r.summary = history.NewSummaryWriter()
+		rCommand.stdout = io.MultiWriter(rCommand.stdout, r.summary)
+		return rCommand
+	})
 	if err != nil {
-		r.statusError(r.command, err)
 		return fmt.Errorf("%s on profile '%s': %w", r.command, r.profile.Name, err)
 	}
-	r.statusSuccess(r.command)
-	clog.Infof("profile '%s': finished '%s'", r.profile.Name, command)
+	r.progressf("profile '%s': finished '%s'", r.profile.Name, command)
 	return nil
 }
 
-func (r *resticWrapper) runPreCommand(command string) error {
-	// Pre/Post commands are only supported for backup
-	if command != constants.CommandBackup {
-		return nil
+// runStepWithRetry runs the step, and runs it again according to the retry configuration of the profile when it fails.
+// A new command is prepared before each attempt. Each attempt is saved in the status file
+func (r *resticWrapper) runStepWithRetry(step string, prepare func() shellCommandDefinition) error {
+	policy, err := newRetryPolicy(r.profile.GetRetry(step))
+	if err != nil {
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		rCommand := prepare()
+		if rCommand.useStdin && policy != nil {
+			// the standard input cannot be read twice
+			clog.Debug("no retry when the backup is reading from stdin")
+			policy = nil
+		}
+		// keep the end of the error output: to match the error pattern, and for the run-* commands
+		r.errorOutput.Reset()
+		if rCommand.stderr != nil {
+			rCommand.stderr = io.MultiWriter(rCommand.stderr, r.errorOutput)
+		} else {
+			rCommand.stderr = r.errorOutput
+		}
+		err = r.runStep(step, rCommand)
+		if err == nil {
+			r.exitCode = 0
+			r.statusSuccess(step, attempt)
+			return nil
+		}
+		r.exitCode = getExitCode(err)
+		r.statusError(step, attempt, err)
+		if !policy.retryable(attempt, err, r.errorOutput.Bytes()) {
+			return err
+		}
+		delay := policy.nextDelay(attempt)
+		clog.Warningf("profile '%s': attempt %d/%d of '%s' failed: %v. Trying again in %s",
+			r.profile.Name, attempt, policy.maxAttempts, step, err, delay)
+		if !r.waitBeforeRetry(delay) {
+			return fmt.Errorf("%w (interrupted before attempt %d)", err, attempt+1)
+		}
+	}
+}
+
+// waitBeforeRetry waits for the delay to elapse. It returns false if the wait was interrupted by a signal
+func (r *resticWrapper) waitBeforeRetry(delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-r.sigChan:
+		// receiving from a nil channel blocks forever
+		return false
+	}
+}
+
+// latestSnapshotTime returns the time of the most recent snapshot in the repository, or a zero time if there's none.
+// The snapshots are filtered using the flags of the "snapshots" section of the profile
+func (r *resticWrapper) latestSnapshotTime() (time.Time, error) {
+	err := r.loadEnvironmentFiles()
+	if err != nil {
+		return time.Time{}, err
 	}
-	if r.profile.Backup == nil || r.profile.Backup.RunBefore == nil || len(r.profile.Backup.RunBefore) == 0 {
+	err = r.resolveSecrets()
+	if err != nil {
+		return time.Time{}, err
+	}
+	args := convertIntoArgs(r.profile.GetCommandFlags(constants.CommandSnapshots))
+	args = append(args, "--json", "--latest", "1")
+	rCommand := r.prepareCommand(constants.CommandSnapshots, args)
+	buffer := &bytes.Buffer{}
+	rCommand.stdout = buffer
+	err = runShellCommand(rCommand)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	snapshots := make([]struct {
+		Time time.Time `json:"time"`
+	}, 0)
+	err = json.Unmarshal(buffer.Bytes(), &snapshots)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot read the list of snapshots: %w", err)
+	}
+	latest := time.Time{}
+	// there's one snapshot for each group of host and paths
+	for _, snapshot := range snapshots {
+		if snapshot.Time.After(latest) {
+			latest = snapshot.Time
+		}
+	}
+	return latest, nil
+}
+
+// notifyFailure runs the 'run-after-fail' commands of the profile, like after a failed run of the command
+func (r *resticWrapper) notifyFailure(fail error) error {
+	err := r.loadEnvironmentFiles()
+	if err != nil {
+		return err
+	}
+	return r.runProfilePostFailCommand(fail)
+}
+
+// runPreCommand runs the 'run-before' commands of the section of the command
+func (r *resticWrapper) runPreCommand(command string) error {
+	runCommands := r.profile.GetRunCommands(command)
+	if len(runCommands.RunBefore) == 0 {
 		return nil
 	}
-	env := append(os.Environ(), r.getEnvironment()...)
-	env = append(env, r.getProfileEnvironment()...)
+	env := r.getHookEnvironment("run-before", nil)
 
-	for i, preCommand := range r.profile.Backup.RunBefore {
-		clog.Debugf("starting pre-backup command %d/%d", i+1, len(r.profile.Backup.RunBefore))
+	for i, preCommand := range runCommands.RunBefore {
+		clog.Debugf("starting pre-%s command %d/%d", command, i+1, len(runCommands.RunBefore))
 		rCommand := newShellCommand(preCommand, nil, env, r.dryRun, r.sigChan, r.setPID)
 		// stdout are stderr are coming from the default terminal (in case they're redirected)
 		rCommand.stdout = term.GetOutput()
 		rCommand.stderr = term.GetErrorOutput()
-		err := runShellCommand(rCommand)
+		rCommand.timeout = runCommands.RunBeforeTimeout
+		err := r.runStep(command+" run-before", rCommand)
 		if err != nil {
-			return fmt.Errorf("run-before backup on profile '%s': %w", r.profile.Name, err)
+			return fmt.Errorf("run-before %s on profile '%s': %w", command, r.profile.Name, err)
 		}
 	}
 	return nil
 }
 
+// runPostCommand runs the 'run-after' commands of the section of the command
 func (r *resticWrapper) runPostCommand(command string) error {
-	// Pre/Post commands are only supported for backup
-	if command != constants.CommandBackup {
+	runCommands := r.profile.GetRunCommands(command)
+	if len(runCommands.RunAfter) == 0 {
 		return nil
 	}
-	if r.profile.Backup == nil || r.profile.Backup.RunAfter == nil || len(r.profile.Backup.RunAfter) == 0 {
+	env := r.getHookEnvironment("run-after", nil)
+
+	for i, postCommand := range runCommands.RunAfter {
+		clog.Debugf("starting post-%s command %d/%d", command, i+1, len(runCommands.RunAfter))
+		rCommand := newShellCommand(postCommand, nil, env, r.dryRun, r.sigChan, r.setPID)
+		// stdout are stderr are coming from the default terminal (in case they're redirected)
+		rCommand.stdout = term.GetOutput()
+		rCommand.stderr = term.GetErrorOutput()
+		rCommand.timeout = runCommands.RunAfterTimeout
+		err := r.runStep(command+" run-after", rCommand)
+		if err != nil {
+			return fmt.Errorf("run-after %s on profile '%s': %w", command, r.profile.Name, err)
+		}
+	}
+	return nil
+}
+
+// runPostFailCommand runs the 'run-after-fail' commands of the section of the command
+func (r *resticWrapper) runPostFailCommand(command string, fail error) error {
+	runCommands := r.profile.GetRunCommands(command)
+	if len(runCommands.RunAfterFail) == 0 {
 		return nil
 	}
-	env := append(os.Environ(), r.getEnvironment()...)
-	env = append(env, r.getProfileEnvironment()...)
+	env := r.getHookEnvironment("run-after-fail", fail)
 
-	for i, postCommand := range r.profile.Backup.RunAfter {
-		clog.Debugf("starting post-backup command %d/%d", i+1, len(r.profile.Backup.RunAfter))
+	for i, postCommand := range runCommands.RunAfterFail {
+		clog.Debugf("starting 'run-after-fail' %s command %d/%d", command, i+1, len(runCommands.RunAfterFail))
 		rCommand := newShellCommand(postCommand, nil, env, r.dryRun, r.sigChan, r.setPID)
 		// stdout are stderr are coming from the default terminal (in case they're redirected)
 		rCommand.stdout = term.GetOutput()
 		rCommand.stderr = term.GetErrorOutput()
-		err := runShellCommand(rCommand)
+		rCommand.timeout = runCommands.RunAfterFailTimeout
+		err := r.runStep(command+" run-after-fail", rCommand)
 		if err != nil {
-			return fmt.Errorf("run-after backup on profile '%s': %w", r.profile.Name, err)
+			return err
 		}
 	}
 	return nil
@@ -273,8 +461,7 @@ func (r *resticWrapper) runProfilePreCommand() error {
 	if r.profile.RunBefore == nil || len(r.profile.RunBefore) == 0 {
 		return nil
 	}
-	env := append(os.Environ(), r.getEnvironment()...)
-	env = append(env, r.getProfileEnvironment()...)
+	env := r.getHookEnvironment("run-before", nil)
 
 	for i, preCommand := range r.profile.RunBefore {
 		clog.Debugf("starting 'run-before' profile command %d/%d", i+1, len(r.profile.RunBefore))
@@ -282,7 +469,8 @@ func (r *resticWrapper) runProfilePreCommand() error {
 		// stdout are stderr are coming from the default terminal (in case they're redirected)
 		rCommand.stdout = term.GetOutput()
 		rCommand.stderr = term.GetErrorOutput()
-		err := runShellCommand(rCommand)
+		rCommand.timeout = r.profile.RunBeforeTimeout
+		err := r.runStep("run-before", rCommand)
 		if err != nil {
 			return fmt.Errorf("run-before on profile '%s': %w", r.profile.Name, err)
 		}
@@ -294,8 +482,7 @@ func (r *resticWrapper) runProfilePostCommand() error {
 	if r.profile.RunAfter == nil || len(r.profile.RunAfter) == 0 {
 		return nil
 	}
-	env := append(os.Environ(), r.getEnvironment()...)
-	env = append(env, r.getProfileEnvironment()...)
+	env := r.getHookEnvironment("run-after", nil)
 
 	for i, postCommand := range r.profile.RunAfter {
 		clog.Debugf("starting 'run-after' profile command %d/%d", i+1, len(r.profile.RunAfter))
@@ -303,7 +490,8 @@ func (r *resticWrapper) runProfilePostCommand() error {
 		// stdout are stderr are coming from the default terminal (in case they're redirected)
 		rCommand.stdout = term.GetOutput()
 		rCommand.stderr = term.GetErrorOutput()
-		err := runShellCommand(rCommand)
+		rCommand.timeout = r.profile.RunAfterTimeout
+		err := r.runStep("run-after", rCommand)
 		if err != nil {
 			return fmt.Errorf("run-after on profile '%s': %w", r.profile.Name, err)
 		}
@@ -315,9 +503,7 @@ func (r *resticWrapper) runProfilePostFailCommand(fail error) error {
 	if r.profile.RunAfterFail == nil || len(r.profile.RunAfterFail) == 0 {
 		return nil
 	}
-	env := append(os.Environ(), r.getEnvironment()...)
-	env = append(env, r.getProfileEnvironment()...)
-	env = append(env, fmt.Sprintf("ERROR=%s", fail.Error()))
+	env := r.getHookEnvironment("run-after-fail", fail)
 
 	for i, postCommand := range r.profile.RunAfterFail {
 		clog.Debugf("starting 'run-after-fail' profile command %d/%d", i+1, len(r.profile.RunAfterFail))
@@ -325,7 +511,8 @@ func (r *resticWrapper) runProfilePostFailCommand(fail error) error {
 		// stdout are stderr are coming from the default terminal (in case they're redirected)
 		rCommand.stdout = term.GetOutput()
 		rCommand.stderr = term.GetErrorOutput()
-		err := runShellCommand(rCommand)
+		rCommand.timeout = r.profile.RunAfterFailTimeout
+		err := r.runStep("run-after-fail", rCommand)
 		if err != nil {
 			return err
 		}
@@ -333,82 +520,269 @@ func (r *resticWrapper) runProfilePostFailCommand(fail error) error {
 	return nil
 }
 
+// runFinallyCommand runs the 'run-finally' commands of the section of the command
+func (r *resticWrapper) runFinallyCommand(command string, fail error) error {
+	runCommands := r.profile.GetRunCommands(command)
+	err := r.runFinally(command+" run-finally", runCommands.RunFinally, runCommands.RunFinallyTimeout, fail)
+	if err != nil {
+		return fmt.Errorf("run-finally %s on profile '%s': %w", command, r.profile.Name, err)
+	}
+	return nil
+}
+
+// runProfileFinallyCommand runs the 'run-finally' commands of the profile
+func (r *resticWrapper) runProfileFinallyCommand(fail error) error {
+	err := r.runFinally("run-finally", r.profile.RunFinally, r.profile.RunFinallyTimeout, fail)
+	if err != nil {
+		return fmt.Errorf("run-finally on profile '%s': %w", r.profile.Name, err)
+	}
+	return nil
+}
+
+// runFinally runs all the commands, even when one of them fails: the first error is returned.
+// The ERROR environment variables are set when the profile failed
+func (r *resticWrapper) runFinally(step string, commands []string, timeout time.Duration, fail error) error {
+	if len(commands) == 0 {
+		return nil
+	}
+	env := r.getHookEnvironment("run-finally", fail)
+
+	var firstErr error
+	for i, finallyCommand := range commands {
+		clog.Debugf("starting '%s' command %d/%d", step, i+1, len(commands))
+		rCommand := newShellCommand(finallyCommand, nil, env, r.dryRun, r.sigChan, r.setPID)
+		// stdout are stderr are coming from the default terminal (in case they're redirected)
+		rCommand.stdout = term.GetOutput()
+		rCommand.stderr = term.GetErrorOutput()
+		rCommand.timeout = timeout
+		err := r.runStep(step, rCommand)
+		if err != nil {
+			clog.Errorf("%s command %d/%d on profile '%s': %v", step, i+1, len(commands), r.profile.Name, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// progressf logs the progress of the run. Nothing is logged when explaining the plan of the profile, since nothing runs
+func (r *resticWrapper) progressf(format string, args ...interface{}) {
+	if r.explain != nil {
+		return
+	}
+	clog.Infof(format, args...)
+}
+
+// runStep runs the shell command, or only records it when explaining the plan of the profile
+func (r *resticWrapper) runStep(step string, command shellCommandDefinition) error {
+	if r.explain != nil {
+		r.explain(step, command)
+		return nil
+	}
+	return runShellCommand(command)
+}
+
+// loadEnvironmentFiles reads all the dotenv files declared in the profile
+func (r *resticWrapper) loadEnvironmentFiles() error {
+	if r.profile.EnvFiles == nil || len(r.profile.EnvFiles) == 0 {
+		return nil
+	}
+	r.envFiles = make(map[string]string)
+	for _, filename := range r.profile.EnvFiles {
+		clog.Debugf("loading environment file '%s'", filename)
+		values, err := dotenv.Load(filename)
+		if err != nil {
+			return fmt.Errorf("cannot load environment file on profile '%s': %w", r.profile.Name, err)
+		}
+		// files loaded later override the values from the previous ones
+		for key, value := range values {
+			r.envFiles[key] = value
+		}
+	}
+	return nil
+}
+
+// resolveSecrets resolves the references to secrets from the password and the environment variables of the profile
+func (r *resticWrapper) resolveSecrets() error {
+	r.secrets = make(map[string]string)
+	for key, value := range r.profile.Environment {
+		if !secret.IsReference(value) {
+			continue
+		}
+		key = strings.ToUpper(key)
+		resolved, err := secret.Resolve(value)
+		if err != nil {
+			return fmt.Errorf("cannot resolve environment variable '%s' on profile '%s': %w", key, r.profile.Name, err)
+		}
+		r.secrets[key] = resolved
+	}
+	// a password command is sent to restic as a flag
+	if r.profile.Password != "" && !secret.IsCommand(r.profile.Password) {
+		resolved, err := secret.Resolve(r.profile.Password)
+		if err != nil {
+			return fmt.Errorf("cannot resolve password on profile '%s': %w", r.profile.Name, err)
+		}
+		r.secrets[constants.EnvResticPassword] = resolved
+	}
+	return nil
+}
+
 // getEnvironment returns the environment variables defined in the profile configuration
+// (variables from the "env" section take precedence over the ones from the environment files)
 func (r *resticWrapper) getEnvironment() []string {
-	if r.profile.Environment == nil || len(r.profile.Environment) == 0 {
+	if len(r.envFiles) == 0 && len(r.profile.Environment) == 0 && len(r.secrets) == 0 {
 		return nil
 	}
-	env := make([]string, len(r.profile.Environment))
-	i := 0
+	env := make([]string, 0, len(r.envFiles)+len(r.profile.Environment)+len(r.secrets))
+	defined := make(map[string]bool, len(r.profile.Environment))
 	for key, value := range r.profile.Environment {
 		// env variables are always uppercase
 		key = strings.ToUpper(key)
+		if resolved, found := r.secrets[key]; found {
+			value = resolved
+		}
 		clog.Debugf("setting up environment variable '%s'", key)
-		env[i] = fmt.Sprintf("%s=%s", key, value)
-		i++
+		env = append(env, fmt.Sprintf("%s=%s", key, value))
+		defined[key] = true
+	}
+	if password, found := r.secrets[constants.EnvResticPassword]; found && !defined[constants.EnvResticPassword] {
+		clog.Debugf("setting up environment variable '%s'", constants.EnvResticPassword)
+		env = append(env, fmt.Sprintf("%s=%s", constants.EnvResticPassword, password))
+		defined[constants.EnvResticPassword] = true
+	}
+	for key, value := range r.envFiles {
+		if defined[strings.ToUpper(key)] {
+			continue
+		}
+		clog.Debugf("setting up environment variable '%s' from file", key)
+		env = append(env, fmt.Sprintf("%s=%s", key, value))
 	}
 	return env
 }
 
-// getProfileEnvironment returns some environment variables about the current profile
-// (name and command for now)
+// getProfileEnvironment returns some environment variables about the current profile and its run
 func (r *resticWrapper) getProfileEnvironment() []string {
-	return []string{
+	env := []string{
 		fmt.Sprintf("PROFILE_NAME=%s", r.profile.Name),
 		fmt.Sprintf("PROFILE_COMMAND=%s", r.command),
+		fmt.Sprintf("PROFILE_REPOSITORY=%s", secret.MaskURL(r.profile.Repository)),
+		fmt.Sprintf("PROFILE_CONFIG=%s", r.profile.GetConfigFile()),
+		fmt.Sprintf("PROFILE_DRY_RUN=%t", r.dryRun),
+	}
+	if !r.start.IsZero() {
+		env = append(env, fmt.Sprintf("PROFILE_DURATION=%d", int64(time.Since(r.start).Seconds())))
 	}
+	if r.exitCode >= 0 {
+		env = append(env, fmt.Sprintf("RESTIC_EXIT_CODE=%d", r.exitCode))
+	}
+	if r.summary != nil {
+		if snapshotID := r.summary.Summary()["snapshot-id"]; snapshotID != "" {
+			env = append(env, fmt.Sprintf("SNAPSHOT_ID=%s", snapshotID))
+		}
+	}
+	return env
+}
+
+// getHookEnvironment returns the environment of a run-* command of the stage (run-before, run-after, run-after-fail or run-finally).
+// The error and the end of the error output of restic are added when the profile failed.
+// Like for the restic command, the environment of the current process is added when running the command
+func (r *resticWrapper) getHookEnvironment(stage string, fail error) []string {
+	env := append(r.getEnvironment(), r.getProfileEnvironment()...)
+	env = append(env, fmt.Sprintf("HOOK_STAGE=%s", stage))
+	if fail == nil {
+		return env
+	}
+	env = append(env, fmt.Sprintf("ERROR=%s", fail.Error()))
+	stderr := r.errorOutput.Bytes()
+	if len(stderr) > maxErrorOutputEnvironment {
+		stderr = stderr[len(stderr)-maxErrorOutputEnvironment:]
+	}
+	if len(stderr) > 0 {
+		env = append(env, fmt.Sprintf("RESTIC_STDERR=%s", strings.TrimSpace(string(stderr))))
+	}
+	return env
 }
 
-func (r *resticWrapper) statusSuccess(command string) {
+// statusSuccess saves the successful run of the command in the status file (after the number of attempts)
+func (r *resticWrapper) statusSuccess(command string, attempts int) {
 	if r.profile.StatusFile == "" {
 		return
 	}
-	var err error
-	switch command {
-	case constants.CommandBackup:
-		status := status.NewStatus(r.profile.StatusFile).Load()
-		status.Profile(r.profile.Name).BackupSuccess()
-		err = status.Save()
-	case constants.CommandCheck:
-		status := status.NewStatus(r.profile.StatusFile).Load()
-		status.Profile(r.profile.Name).CheckSuccess()
-		err = status.Save()
-	case constants.SectionConfigurationRetention, constants.CommandForget:
-		status := status.NewStatus(r.profile.StatusFile).Load()
-		status.Profile(r.profile.Name).RetentionSuccess()
-		err = status.Save()
-	}
+	err := status.NewStatus(r.profile.StatusFile).Update(func(status *status.Status) {
+		for _, key := range statusKeys(command) {
+			status.Profile(r.profile.Name).CommandSuccess(key).CommandAttempts(key, attempts)
+		}
+	})
 	if err != nil {
 		// not important enough to throw an error here
 		clog.Warningf("saving status file '%s': %v", r.profile.StatusFile, err)
 	}
 }
 
-func (r *resticWrapper) statusError(command string, fail error) {
+// statusError saves the failed attempt of the command in the status file
+func (r *resticWrapper) statusError(command string, attempt int, fail error) {
 	if r.profile.StatusFile == "" {
 		return
 	}
-	var err error
-	switch command {
-	case constants.CommandBackup:
-		status := status.NewStatus(r.profile.StatusFile).Load()
-		status.Profile(r.profile.Name).BackupError(fail)
-		err = status.Save()
-	case constants.CommandCheck:
-		status := status.NewStatus(r.profile.StatusFile).Load()
-		status.Profile(r.profile.Name).CheckError(fail)
-		err = status.Save()
-	case constants.SectionConfigurationRetention, constants.CommandForget:
-		status := status.NewStatus(r.profile.StatusFile).Load()
-		status.Profile(r.profile.Name).RetentionError(fail)
-		err = status.Save()
-	}
+	err := status.NewStatus(r.profile.StatusFile).Update(func(status *status.Status) {
+		for _, key := range statusKeys(command) {
+			status.Profile(r.profile.Name).CommandError(key, fail).CommandAttempts(key, attempt)
+		}
+	})
 	if err != nil {
 		// not important enough to throw an error here
 		clog.Warningf("saving status file '%s': %v", r.profile.StatusFile, err)
 	}
 }
 
+// statusKeys returns the keys of the status file receiving the result of the command.
+// A scheduled retention runs as a "forget" command: it also updates the "retention" key
+func statusKeys(command string) []string {
+	if command == constants.CommandForget {
+		return []string{constants.CommandForget, constants.SectionConfigurationRetention}
+	}
+	return []string{command}
+}
+
+// saveHistory appends the run of the profile command to the history file, and removes the entries older than the retention
+func (r *resticWrapper) saveHistory(start, end time.Time, fail error) {
+	if r.profile.HistoryFile == "" || r.dryRun {
+		return
+	}
+	entry := history.NewEntry(r.profile.Name, r.command, start, end)
+	entry.Host = getHostname()
+	if fail != nil {
+		entry.Success = false
+		entry.ExitCode = getExitCode(fail)
+		entry.Error = fail.Error()
+	}
+	if r.summary != nil {
+		entry.Summary = r.summary.Summary()
+	}
+	runHistory := history.NewHistory(r.profile.HistoryFile)
+	err := runHistory.Append(entry)
+	if err != nil {
+		clog.Warningf("saving history file '%s': %v", r.profile.HistoryFile, err)
+		return
+	}
+	if r.profile.HistoryMaxAge > 0 {
+		_, err = runHistory.Clean(end.Add(-r.profile.HistoryMaxAge))
+		if err != nil {
+			clog.Warningf("cleaning history file '%s': %v", r.profile.HistoryFile, err)
+		}
+	}
+}
+
+// getExitCode returns the exit code of the command which failed, or -1 when the error didn't come from a command
+func getExitCode(err error) int {
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) {
+		return exitError.ExitCode()
+	}
+	return -1
+}
+
 func convertIntoArgs(flags map[string][]string) []string {
 	args := make([]string, 0)
 